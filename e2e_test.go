@@ -0,0 +1,431 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	"github.com/argoproj/gitops-engine/pkg/health"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"rwslinkman/kargo-promotion-check-ext-argo/internal"
+	"rwslinkman/kargo-promotion-check-ext-argo/internal/fakeargocd"
+	"syscall"
+	"testing"
+	"time"
+)
+
+const e2eRevision = "3f2a9c1d8e7b6a5f4e3d2c1b0a9f8e7d6c5b4a39"
+
+// kpceaBinary is the path of the binary that the end-to-end tests run, it is built once in TestMain
+var kpceaBinary string
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	if testing.Short() {
+		os.Exit(m.Run())
+	}
+	dir, err := os.MkdirTemp("", "kpcea-e2e")
+	if err != nil {
+		panic(err)
+	}
+	kpceaBinary = filepath.Join(dir, "kpcea")
+	build := exec.Command("go", "build", "-o", kpceaBinary, ".")
+	build.Stderr = os.Stderr
+	if err = build.Run(); err != nil {
+		panic(err)
+	}
+	code := m.Run()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func startFakeArgoCD(t *testing.T) *fakeargocd.Server {
+	t.Helper()
+	server, err := fakeargocd.NewServer("api-token")
+	if err != nil {
+		t.Fatalf("failed to start fake ArgoCD: %v", err)
+	}
+	t.Cleanup(server.Close)
+	return server
+}
+
+// runKPCEA runs the binary against the fake ArgoCD, and returns the exit code and the JSON report.
+func runKPCEA(t *testing.T, server *fakeargocd.Server, env map[string]string) (int, internal.Report) {
+	t.Helper()
+	cmd, stdout, stderr := startKPCEA(t, server, env)
+	return waitKPCEA(t, cmd, stdout, stderr)
+}
+
+// startKPCEA starts the binary against the fake ArgoCD, without waiting for it to complete.
+func startKPCEA(t *testing.T, server *fakeargocd.Server, env map[string]string) (*exec.Cmd, *bytes.Buffer, *bytes.Buffer) {
+	t.Helper()
+	cmd := exec.Command(kpceaBinary)
+	cmd.Env = []string{
+		"ARGOCD_SERVER=http://" + server.Addr,
+		"ARGOCD_APP_NAME=api",
+		"KPCEA_INTERVAL=1",
+		"KPCEA_TIMEOUT=10",
+		"KPCEA_OUTPUT=json",
+	}
+	for key, value := range env {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", key, value))
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("failed to start KPCEA: %v", err)
+	}
+	return cmd, &stdout, &stderr
+}
+
+// waitKPCEA waits for the binary to complete, and returns the exit code and the JSON report.
+func waitKPCEA(t *testing.T, cmd *exec.Cmd, stdout *bytes.Buffer, stderr *bytes.Buffer) (int, internal.Report) {
+	t.Helper()
+	exitCode := 0
+	var exitErr *exec.ExitError
+	if err := cmd.Wait(); errors.As(err, &exitErr) {
+		exitCode = exitErr.ExitCode()
+	} else if err != nil {
+		t.Fatalf("failed to run KPCEA: %v", err)
+	}
+	var report internal.Report
+	if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+		t.Fatalf("failed to decode report %q: %v\n%s", stdout.String(), err, stderr.String())
+	}
+	return exitCode, report
+}
+
+func TestE2E_ReachesExpectedState(t *testing.T) {
+	if testing.Short() {
+		t.Skip("end-to-end test")
+	}
+	server := startFakeArgoCD(t)
+	server.ScriptApp("api",
+		fakeargocd.App("api", v1alpha1.SyncStatusCodeOutOfSync, health.HealthStatusHealthy, "9b8c7d6e5f4a3b2c1d0e9f8a7b6c5d4e3f2a1b0c"),
+		fakeargocd.App("api", v1alpha1.SyncStatusCodeSynced, health.HealthStatusProgressing, e2eRevision),
+		fakeargocd.App("api", v1alpha1.SyncStatusCodeSynced, health.HealthStatusHealthy, e2eRevision),
+	)
+
+	exitCode, report := runKPCEA(t, server, map[string]string{
+		"ARGOCD_API_TOKEN":      "api-token",
+		"KPCEA_TARGET_REVISION": "3f2a9c1",
+	})
+
+	assert.Equal(t, exitSuccess, exitCode)
+	assert.True(t, report.InExpectedState)
+	assert.Len(t, report.Apps, 1)
+	assert.Equal(t, 3, report.Apps[0].Attempts)
+	assert.Equal(t, e2eRevision, report.Apps[0].ObservedRevision)
+}
+
+func TestE2E_TerminalFailure(t *testing.T) {
+	if testing.Short() {
+		t.Skip("end-to-end test")
+	}
+	server := startFakeArgoCD(t)
+	server.ScriptApp("api",
+		fakeargocd.App("api", v1alpha1.SyncStatusCodeSynced, health.HealthStatusProgressing, e2eRevision),
+		fakeargocd.App("api", v1alpha1.SyncStatusCodeSynced, health.HealthStatusDegraded, e2eRevision),
+	)
+
+	exitCode, report := runKPCEA(t, server, map[string]string{
+		"ARGOCD_API_TOKEN":      "api-token",
+		"KPCEA_TARGET_REVISION": e2eRevision,
+		"KPCEA_FAILURE_GRACE":   "0",
+	})
+
+	assert.Equal(t, exitTerminalFailure, exitCode)
+	assert.False(t, report.InExpectedState)
+	assert.Equal(t, "app health is Degraded", report.Apps[0].FailureReason)
+}
+
+func TestE2E_MultipleApps(t *testing.T) {
+	if testing.Short() {
+		t.Skip("end-to-end test")
+	}
+	server := startFakeArgoCD(t)
+	server.ScriptApp("api", fakeargocd.App("api", v1alpha1.SyncStatusCodeSynced, health.HealthStatusHealthy, e2eRevision))
+	server.ScriptApp("worker", fakeargocd.App("worker", v1alpha1.SyncStatusCodeSynced, health.HealthStatusDegraded, e2eRevision))
+
+	exitCode, report := runKPCEA(t, server, map[string]string{
+		"ARGOCD_API_TOKEN":      "api-token",
+		"ARGOCD_APP_NAME":       "api,worker",
+		"KPCEA_TARGET_REVISION": e2eRevision,
+		"KPCEA_FAILURE_GRACE":   "0",
+	})
+
+	assert.Equal(t, exitTerminalFailure, exitCode)
+	assert.False(t, report.InExpectedState)
+	assert.Equal(t, exitTerminalFailure, report.ExitCode)
+	assert.Len(t, report.Apps, 2)
+	assert.Equal(t, "api", report.Apps[0].App)
+	assert.Equal(t, exitSuccess, report.Apps[0].ExitCode)
+	assert.Equal(t, "worker", report.Apps[1].App)
+	assert.Equal(t, exitTerminalFailure, report.Apps[1].ExitCode)
+	assert.Equal(t, "app health is Degraded", report.Apps[1].FailureReason)
+}
+
+func TestE2E_Timeout(t *testing.T) {
+	if testing.Short() {
+		t.Skip("end-to-end test")
+	}
+	server := startFakeArgoCD(t)
+	server.ScriptApp("api", fakeargocd.App("api", v1alpha1.SyncStatusCodeOutOfSync, health.HealthStatusHealthy, e2eRevision))
+
+	exitCode, report := runKPCEA(t, server, map[string]string{
+		"ARGOCD_API_TOKEN":      "api-token",
+		"KPCEA_TARGET_REVISION": e2eRevision,
+		"KPCEA_TIMEOUT":         "2",
+	})
+
+	assert.Equal(t, exitNotInState, exitCode)
+	assert.Equal(t, "app did not reach the expected state within 2s: app is OutOfSync and Healthy", report.Apps[0].FailureReason)
+}
+
+func TestE2E_LoginWithGRPCAndCommitMessage(t *testing.T) {
+	if testing.Short() {
+		t.Skip("end-to-end test")
+	}
+	server := startFakeArgoCD(t)
+	server.SetLogin("kpcea", "password")
+	server.ScriptApp("api", fakeargocd.App("api", v1alpha1.SyncStatusCodeSynced, health.HealthStatusHealthy, e2eRevision))
+	server.SetRevisionMetadata(e2eRevision, &v1alpha1.RevisionMetadata{Message: "chore: promote api to v1.4.2"})
+
+	exitCode, report := runKPCEA(t, server, map[string]string{
+		"ARGOCD_API_USERNAME":     "kpcea",
+		"ARGOCD_API_PASSWORD":     "password",
+		"KPCEA_USE_GRPC":          "true",
+		"KPCEA_VERIFY_MODE":       "SEARCH_COMMIT_MSG",
+		"KPCEA_SEARCH_COMMIT_MSG": "v1.4.2",
+	})
+
+	assert.Equal(t, exitSuccess, exitCode)
+	assert.Equal(t, "chore: promote api to v1.4.2", report.Apps[0].CommitMessage)
+}
+
+func TestE2E_WatchAndSync(t *testing.T) {
+	if testing.Short() {
+		t.Skip("end-to-end test")
+	}
+	server := startFakeArgoCD(t)
+	syncing := fakeargocd.App("api", v1alpha1.SyncStatusCodeOutOfSync, health.HealthStatusProgressing, e2eRevision)
+	syncing.Status.OperationState = &v1alpha1.OperationState{Phase: "Succeeded"}
+	server.ScriptApp("api",
+		syncing,
+		fakeargocd.App("api", v1alpha1.SyncStatusCodeSynced, health.HealthStatusProgressing, e2eRevision),
+		fakeargocd.App("api", v1alpha1.SyncStatusCodeSynced, health.HealthStatusHealthy, e2eRevision),
+	)
+
+	exitCode, report := runKPCEA(t, server, map[string]string{
+		"ARGOCD_API_TOKEN":      "api-token",
+		"KPCEA_TARGET_REVISION": e2eRevision,
+		"KPCEA_WAIT_MODE":       "WATCH",
+		"KPCEA_TRIGGER_SYNC":    "true",
+	})
+
+	assert.Equal(t, exitSuccess, exitCode)
+	assert.True(t, report.InExpectedState)
+	assert.Len(t, server.SyncRequests(), 1)
+	assert.Equal(t, e2eRevision, server.SyncRequests()[0].GetRevision())
+}
+
+func TestE2E_AbortedBySIGTERM(t *testing.T) {
+	if testing.Short() {
+		t.Skip("end-to-end test")
+	}
+	server := startFakeArgoCD(t)
+	server.ScriptApp("api", fakeargocd.App("api", v1alpha1.SyncStatusCodeOutOfSync, health.HealthStatusHealthy, e2eRevision))
+
+	cmd, stdout, stderr := startKPCEA(t, server, map[string]string{
+		"ARGOCD_API_TOKEN":      "api-token",
+		"KPCEA_TARGET_REVISION": e2eRevision,
+	})
+	time.Sleep(1500 * time.Millisecond)
+	if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		t.Fatalf("failed to send SIGTERM: %v", err)
+	}
+	exitCode, report := waitKPCEA(t, cmd, stdout, stderr)
+
+	assert.Equal(t, exitAborted, exitCode)
+	assert.False(t, report.InExpectedState)
+	assert.Equal(t, "verification was aborted: terminated signal received", report.FailureReason)
+	assert.Equal(t, "verification was aborted: terminated signal received", report.Apps[0].FailureReason)
+	assert.Less(t, report.ElapsedSeconds, 5.0)
+}
+
+func TestE2E_InvalidConfiguration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("end-to-end test")
+	}
+	server := startFakeArgoCD(t)
+
+	exitCode, report := runKPCEA(t, server, map[string]string{
+		"ARGOCD_APP_NAME": "",
+	})
+
+	assert.Equal(t, exitSetupFailure, exitCode)
+	assert.False(t, report.InExpectedState)
+	assert.Equal(t, "ARGOCD_SERVER and ARGOCD_APP_NAME must be set", report.FailureReason)
+}
+
+func TestE2E_LoginRejected(t *testing.T) {
+	if testing.Short() {
+		t.Skip("end-to-end test")
+	}
+	server := startFakeArgoCD(t)
+	server.SetLogin("kpcea", "password")
+
+	exitCode, report := runKPCEA(t, server, map[string]string{
+		"ARGOCD_API_USERNAME":   "kpcea",
+		"ARGOCD_API_PASSWORD":   "wrong-password",
+		"KPCEA_TARGET_REVISION": e2eRevision,
+	})
+
+	assert.Equal(t, exitSetupFailure, exitCode)
+	assert.Equal(t, "token request not accepted by ArgoCD (http 401)", report.FailureReason)
+	assert.Empty(t, report.Apps)
+}
+
+func TestE2E_LogsInAgainWhenSessionExpires(t *testing.T) {
+	if testing.Short() {
+		t.Skip("end-to-end test")
+	}
+	server := startFakeArgoCD(t)
+	server.SetLogin("kpcea", "password")
+	server.ScriptApp("api", fakeargocd.App("api", v1alpha1.SyncStatusCodeOutOfSync, health.HealthStatusHealthy, e2eRevision))
+
+	cmd, stdout, stderr := startKPCEA(t, server, map[string]string{
+		"ARGOCD_API_USERNAME":   "kpcea",
+		"ARGOCD_API_PASSWORD":   "password",
+		"KPCEA_TARGET_REVISION": e2eRevision,
+	})
+	time.Sleep(1500 * time.Millisecond)
+	// The session of KPCEA expires, and the app reaches the expected state
+	server.SetToken("next-session")
+	server.ScriptApp("api", fakeargocd.App("api", v1alpha1.SyncStatusCodeSynced, health.HealthStatusHealthy, e2eRevision))
+	exitCode, report := waitKPCEA(t, cmd, stdout, stderr)
+
+	assert.Equal(t, exitSuccess, exitCode)
+	assert.True(t, report.InExpectedState)
+}
+
+// startUnresponsiveArgoCD accepts connections, but never responds to a request.
+func startUnresponsiveArgoCD(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	return "http://" + listener.Addr().String()
+}
+
+func TestE2E_LoginTimeout(t *testing.T) {
+	if testing.Short() {
+		t.Skip("end-to-end test")
+	}
+	server := startFakeArgoCD(t)
+
+	exitCode, report := runKPCEA(t, server, map[string]string{
+		"ARGOCD_SERVER":         startUnresponsiveArgoCD(t),
+		"ARGOCD_API_USERNAME":   "kpcea",
+		"ARGOCD_API_PASSWORD":   "password",
+		"KPCEA_TARGET_REVISION": e2eRevision,
+		"KPCEA_TIMEOUT":         "1",
+	})
+
+	assert.Equal(t, exitNotInState, exitCode)
+	assert.False(t, report.InExpectedState)
+	assert.Contains(t, report.FailureReason, "unable to connect to ArgoCD within 1s: ")
+	assert.Contains(t, report.FailureReason, "context deadline exceeded")
+}
+
+func TestE2E_LoginAbortedBySIGTERM(t *testing.T) {
+	if testing.Short() {
+		t.Skip("end-to-end test")
+	}
+	server := startFakeArgoCD(t)
+
+	cmd, stdout, stderr := startKPCEA(t, server, map[string]string{
+		"ARGOCD_SERVER":         startUnresponsiveArgoCD(t),
+		"ARGOCD_API_USERNAME":   "kpcea",
+		"ARGOCD_API_PASSWORD":   "password",
+		"KPCEA_TARGET_REVISION": e2eRevision,
+	})
+	time.Sleep(500 * time.Millisecond)
+	if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		t.Fatalf("failed to send SIGTERM: %v", err)
+	}
+	exitCode, report := waitKPCEA(t, cmd, stdout, stderr)
+
+	assert.Equal(t, exitAborted, exitCode)
+	assert.Equal(t, "verification was aborted: terminated signal received", report.FailureReason)
+}
+
+func TestE2E_ServeAbortsChecksOnSIGTERM(t *testing.T) {
+	if testing.Short() {
+		t.Skip("end-to-end test")
+	}
+	server := startFakeArgoCD(t)
+	server.ScriptApp("api", fakeargocd.App("api", v1alpha1.SyncStatusCodeOutOfSync, health.HealthStatusHealthy, e2eRevision))
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to find a free port: %v", err)
+	}
+	address := listener.Addr().String()
+	_ = listener.Close()
+
+	cmd := exec.Command(kpceaBinary, "serve")
+	cmd.Env = []string{
+		"ARGOCD_SERVER=http://" + server.Addr,
+		"ARGOCD_API_TOKEN=api-token",
+		"KPCEA_INTERVAL=1",
+		"KPCEA_LISTEN_ADDRESS=" + address,
+	}
+	if err = cmd.Start(); err != nil {
+		t.Fatalf("failed to start KPCEA: %v", err)
+	}
+	t.Cleanup(func() { _ = cmd.Process.Kill() })
+	for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(100 * time.Millisecond) {
+		// Wait until the server listens
+		response, getErr := http.Get("http://" + address + "/healthz")
+		if getErr == nil {
+			_ = response.Body.Close()
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("server did not start: %v", getErr)
+		}
+	}
+	responses := make(chan *http.Response, 1)
+	go func() {
+		response, getErr := http.Get("http://" + address + "/v1/check?app=api&revision=3f2a9c1&timeout=60")
+		if getErr == nil {
+			responses <- response
+		}
+	}()
+	time.Sleep(1500 * time.Millisecond)
+	if err = cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		t.Fatalf("failed to send SIGTERM: %v", err)
+	}
+
+	var report internal.Report
+	select {
+	case response := <-responses:
+		defer response.Body.Close()
+		assert.NoError(t, json.NewDecoder(response.Body).Decode(&report))
+	case <-time.After(10 * time.Second):
+		t.Fatalf("check was not aborted")
+	}
+	assert.Equal(t, exitAborted, report.ExitCode)
+	assert.Equal(t, "verification was aborted: terminated signal received", report.Apps[0].FailureReason)
+	assert.NoError(t, cmd.Wait())
+}
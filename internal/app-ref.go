@@ -0,0 +1,64 @@
+package internal
+
+import (
+	"github.com/argoproj/argo-cd/v2/pkg/apiclient/application"
+	"strings"
+)
+
+// AppRef identifies an Argo app. Namespace and Project are optional, ArgoCD uses its control plane namespace by default.
+type AppRef struct {
+	Name      string
+	Namespace string
+	Project   string
+}
+
+// ParseAppRef reads an app name, which may use the namespace/name shorthand of the argocd CLI.
+// The namespace from the shorthand takes precedence over the given namespace.
+func ParseAppRef(value string, namespace string, project string) AppRef {
+	if appNamespace, appName, found := strings.Cut(value, "/"); found {
+		return AppRef{Name: appName, Namespace: appNamespace, Project: project}
+	}
+	return AppRef{Name: value, Namespace: namespace, Project: project}
+}
+
+func (r AppRef) String() string {
+	if r.Namespace == "" {
+		return r.Name
+	}
+	return r.Namespace + "/" + r.Name
+}
+
+// Query creates the query to get the Argo app from ArgoCD.
+func (r AppRef) Query() *application.ApplicationQuery {
+	query := &application.ApplicationQuery{Name: &r.Name, AppNamespace: r.namespace()}
+	if r.Project != "" {
+		query.Project = []string{r.Project}
+	}
+	return query
+}
+
+// RevisionMetadataQuery creates the query to get the metadata of a revision of the Argo app.
+func (r AppRef) RevisionMetadataQuery(revision string) *application.RevisionMetadataQuery {
+	return &application.RevisionMetadataQuery{
+		Name:         &r.Name,
+		AppNamespace: r.namespace(),
+		Project:      r.project(),
+		Revision:     &revision,
+	}
+}
+
+func (r AppRef) namespace() *string {
+	return optional(r.Namespace)
+}
+
+func (r AppRef) project() *string {
+	return optional(r.Project)
+}
+
+// optional turns an empty value into nil, so it is left out of the request to ArgoCD.
+func optional(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
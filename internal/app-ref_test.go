@@ -0,0 +1,50 @@
+package internal
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseAppRef(t *testing.T) {
+	tests := []struct {
+		value     string
+		namespace string
+		expected  AppRef
+	}{
+		{"api", "", AppRef{Name: "api"}},
+		{"api", "team-payments", AppRef{Name: "api", Namespace: "team-payments"}},
+		{"team-payments/api", "", AppRef{Name: "api", Namespace: "team-payments"}},
+		{"team-payments/api", "argocd", AppRef{Name: "api", Namespace: "team-payments"}},
+	}
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			assert.Equal(t, test.expected, ParseAppRef(test.value, test.namespace, ""))
+		})
+	}
+}
+
+func TestAppRef_String(t *testing.T) {
+	assert.Equal(t, "api", AppRef{Name: "api"}.String())
+	assert.Equal(t, "team-payments/api", AppRef{Name: "api", Namespace: "team-payments", Project: "payments"}.String())
+}
+
+func TestAppRef_Query(t *testing.T) {
+	plainQuery := AppRef{Name: "api"}.Query()
+	fullQuery := AppRef{Name: "api", Namespace: "team-payments", Project: "payments"}.Query()
+
+	assert.Equal(t, "api", plainQuery.GetName())
+	assert.Nil(t, plainQuery.AppNamespace)
+	assert.Empty(t, plainQuery.Project)
+	assert.Equal(t, "api", fullQuery.GetName())
+	assert.Equal(t, "team-payments", fullQuery.GetAppNamespace())
+	assert.Equal(t, []string{"payments"}, fullQuery.Project)
+}
+
+func TestAppRef_RevisionMetadataQuery(t *testing.T) {
+	query := AppRef{Name: "api", Namespace: "team-payments", Project: "payments"}.RevisionMetadataQuery("abc123")
+
+	assert.Equal(t, "api", query.GetName())
+	assert.Equal(t, "team-payments", query.GetAppNamespace())
+	assert.Equal(t, "payments", query.GetProject())
+	assert.Equal(t, "abc123", query.GetRevision())
+}
@@ -0,0 +1,189 @@
+package internal
+
+import (
+	"context"
+	"github.com/argoproj/argo-cd/v2/pkg/apiclient/application"
+	"github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	"google.golang.org/grpc"
+	"k8s.io/apimachinery/pkg/watch"
+	"log/slog"
+	"time"
+)
+
+type ApplicationGetClient interface {
+	Get(ctx context.Context, in *application.ApplicationQuery, opts ...grpc.CallOption) (*v1alpha1.Application, error)
+}
+
+type ApplicationWatchClient interface {
+	ApplicationGetClient
+	Watch(ctx context.Context, in *application.ApplicationQuery, opts ...grpc.CallOption) (application.ApplicationService_WatchClient, error)
+}
+
+// AppSource delivers the state of an Argo app each time it should be verified.
+type AppSource interface {
+	Next(ctx context.Context) (*v1alpha1.Application, error)
+}
+
+// AppPoller fetches the Argo app on a fixed interval.
+type AppPoller struct {
+	client   ApplicationGetClient
+	query    *application.ApplicationQuery
+	interval time.Duration
+	refresh  v1alpha1.RefreshType
+	logger   *slog.Logger
+	polled   bool
+}
+
+// NewAppPoller creates a poller for the Argo app. When refresh is set, the first fetch asks ArgoCD to refresh the app.
+func NewAppPoller(client ApplicationGetClient, query *application.ApplicationQuery, interval time.Duration, refresh v1alpha1.RefreshType, logger *slog.Logger) *AppPoller {
+	return &AppPoller{
+		client:   client,
+		query:    query,
+		interval: interval,
+		refresh:  refresh,
+		logger:   logger,
+	}
+}
+
+// Next fetches the app right away on the first call, and waits for the poll interval on every call after that.
+func (p *AppPoller) Next(ctx context.Context) (*v1alpha1.Application, error) {
+	if p.polled {
+		if err := sleep(ctx, p.interval); err != nil {
+			return nil, err
+		}
+		return fetchApp(ctx, p.logger, p.client, p.query, "")
+	}
+	p.polled = true
+	return fetchApp(ctx, p.logger, p.client, p.query, p.refresh)
+}
+
+// AppWatcher follows the Watch stream of the Argo app and delivers every change as soon as ArgoCD reports it.
+// When the stream cannot be opened or drops, the app is fetched once and the stream is resubscribed after the poll interval.
+type AppWatcher struct {
+	client   ApplicationWatchClient
+	query    *application.ApplicationQuery
+	interval time.Duration
+	refresh  v1alpha1.RefreshType
+	logger   *slog.Logger
+	updates  chan *v1alpha1.Application
+	last     *v1alpha1.Application
+}
+
+// NewAppWatcher starts watching the Argo app until ctx is done.
+// When refresh is set, the app is fetched and refreshed once before the stream is opened.
+func NewAppWatcher(ctx context.Context, client ApplicationWatchClient, query *application.ApplicationQuery, interval time.Duration, refresh v1alpha1.RefreshType, logger *slog.Logger) *AppWatcher {
+	watcher := &AppWatcher{
+		client:   client,
+		query:    query,
+		interval: interval,
+		refresh:  refresh,
+		logger:   logger,
+		updates:  make(chan *v1alpha1.Application, 1),
+	}
+	go watcher.run(ctx)
+	return watcher
+}
+
+// Next returns the latest state of the app that has not been delivered yet, or waits for the next change.
+// When nothing changed within the poll interval, the last known state is delivered again so time-based checks can progress.
+func (w *AppWatcher) Next(ctx context.Context) (*v1alpha1.Application, error) {
+	var interval <-chan time.Time
+	if w.last != nil {
+		timer := time.NewTimer(w.interval)
+		defer timer.Stop()
+		interval = timer.C
+	}
+	select {
+	case app := <-w.updates:
+		w.last = app
+		return app, nil
+	case <-interval:
+		return w.last, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (w *AppWatcher) run(ctx context.Context) {
+	if w.refresh != "" {
+		app, err := fetchApp(ctx, w.logger, w.client, w.query, w.refresh)
+		if err != nil {
+			w.logger.Warn("Failed to fetch app details", "error", err)
+		} else {
+			w.deliver(app)
+		}
+	}
+	for ctx.Err() == nil {
+		w.watch(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		// Stream is not available, poll once and resubscribe after the interval
+		app, err := fetchApp(ctx, w.logger, w.client, w.query, "")
+		if err != nil {
+			w.logger.Warn("Failed to fetch app details", "error", err)
+		} else {
+			w.deliver(app)
+		}
+		if sleep(ctx, w.interval) != nil {
+			return
+		}
+	}
+}
+
+func (w *AppWatcher) watch(ctx context.Context) {
+	w.logger.Info("Watching app details from ArgoCD")
+	stream, err := w.client.Watch(ctx, w.query)
+	if err != nil {
+		w.logger.Warn("Failed to watch app details", "error", err)
+		return
+	}
+	for {
+		event, recvErr := stream.Recv()
+		if recvErr != nil {
+			if ctx.Err() == nil {
+				w.logger.Warn("Watch stream dropped, falling back to polling", "error", recvErr)
+			}
+			return
+		}
+		if event.Type == watch.Deleted {
+			continue
+		}
+		w.deliver(&event.Application)
+	}
+}
+
+// deliver replaces any update that has not been picked up yet, so Next always returns the latest state.
+func (w *AppWatcher) deliver(app *v1alpha1.Application) {
+	select {
+	case <-w.updates:
+	default:
+	}
+	w.updates <- app
+}
+
+// fetchApp gets the Argo app, and asks ArgoCD to refresh it first when a refresh type is given.
+// A refresh makes ArgoCD re-read git and the live cluster instead of serving cached state.
+func fetchApp(ctx context.Context, logger *slog.Logger, client ApplicationGetClient, query *application.ApplicationQuery, refresh v1alpha1.RefreshType) (*v1alpha1.Application, error) {
+	if refresh == "" {
+		logger.Debug("Fetching app details from ArgoCD")
+		return client.Get(ctx, query)
+	}
+	logger.Info("Fetching app details from ArgoCD", "refresh", refresh)
+	refreshQuery := *query
+	refreshValue := string(refresh)
+	refreshQuery.Refresh = &refreshValue
+	return client.Get(ctx, &refreshQuery)
+}
+
+func sleep(ctx context.Context, duration time.Duration) error {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,277 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"github.com/argoproj/argo-cd/v2/pkg/apiclient/application"
+	"github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"k8s.io/apimachinery/pkg/watch"
+	"maps"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newApp(revision string) *v1alpha1.Application {
+	return &v1alpha1.Application{
+		Status: v1alpha1.ApplicationStatus{Sync: v1alpha1.SyncStatus{Revision: revision}},
+	}
+}
+
+type MockWatchStream struct {
+	grpc.ClientStream
+	events chan *v1alpha1.ApplicationWatchEvent
+	err    error
+}
+
+func (m *MockWatchStream) Recv() (*v1alpha1.ApplicationWatchEvent, error) {
+	event, ok := <-m.events
+	if !ok {
+		return nil, m.err
+	}
+	return event, nil
+}
+
+type MockWatchClient struct {
+	mu   sync.Mutex
+	apps []*v1alpha1.Application
+	// appAfterStreams is returned by Get once all streams were handed out, instead of apps
+	appAfterStreams *v1alpha1.Application
+	getErr          error
+	gets            int
+	refreshes       []string
+	streams         []*MockWatchStream
+	watchErr        error
+	watchCalls      int
+}
+
+func (m *MockWatchClient) Get(_ context.Context, in *application.ApplicationQuery, _ ...grpc.CallOption) (*v1alpha1.Application, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.gets++
+	m.refreshes = append(m.refreshes, in.GetRefresh())
+	if m.getErr != nil {
+		return nil, m.getErr
+	}
+	if m.appAfterStreams != nil && len(m.streams) == 0 {
+		return m.appAfterStreams, nil
+	}
+	app := m.apps[0]
+	if len(m.apps) > 1 {
+		m.apps = m.apps[1:]
+	}
+	return app, nil
+}
+
+func (m *MockWatchClient) Watch(ctx context.Context, _ *application.ApplicationQuery, _ ...grpc.CallOption) (application.ApplicationService_WatchClient, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.watchCalls++
+	if m.watchErr != nil {
+		return nil, m.watchErr
+	}
+	if len(m.streams) == 0 {
+		// Block like an idle stream until the watcher is stopped
+		stream := &MockWatchStream{events: make(chan *v1alpha1.ApplicationWatchEvent), err: context.Canceled}
+		go func() {
+			<-ctx.Done()
+			close(stream.events)
+		}()
+		return stream, nil
+	}
+	stream := m.streams[0]
+	m.streams = m.streams[1:]
+	return stream, nil
+}
+
+func (m *MockWatchClient) counts() (int, int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.gets, m.watchCalls
+}
+
+func newMockWatchStream(err error, apps ...*v1alpha1.Application) *MockWatchStream {
+	stream := &MockWatchStream{events: make(chan *v1alpha1.ApplicationWatchEvent, len(apps)), err: err}
+	for _, app := range apps {
+		stream.events <- &v1alpha1.ApplicationWatchEvent{Type: watch.Modified, Application: *app}
+	}
+	close(stream.events)
+	return stream
+}
+
+func nextWithin(t *testing.T, source AppSource, timeout time.Duration) (*v1alpha1.Application, error) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return source.Next(ctx)
+}
+
+func TestAppPoller_Next_FetchesImmediatelyThenAfterInterval(t *testing.T) {
+	mockClient := &MockWatchClient{apps: []*v1alpha1.Application{newApp("first"), newApp("second")}}
+	poller := NewAppPoller(mockClient, &application.ApplicationQuery{}, 20*time.Millisecond, "", testLogger)
+
+	start := time.Now()
+	first, firstErr := nextWithin(t, poller, time.Second)
+	firstElapsed := time.Since(start)
+	second, secondErr := nextWithin(t, poller, time.Second)
+	secondElapsed := time.Since(start)
+
+	assert.NoError(t, firstErr)
+	assert.Equal(t, "first", first.Status.Sync.Revision)
+	assert.Less(t, firstElapsed, 20*time.Millisecond)
+	assert.NoError(t, secondErr)
+	assert.Equal(t, "second", second.Status.Sync.Revision)
+	assert.GreaterOrEqual(t, secondElapsed, 20*time.Millisecond)
+}
+
+func TestAppPoller_Next_RefreshesOnFirstFetchOnly(t *testing.T) {
+	mockClient := &MockWatchClient{apps: []*v1alpha1.Application{newApp("first")}}
+	query := &application.ApplicationQuery{}
+	poller := NewAppPoller(mockClient, query, time.Millisecond, v1alpha1.RefreshTypeHard, testLogger)
+
+	_, firstErr := nextWithin(t, poller, time.Second)
+	_, secondErr := nextWithin(t, poller, time.Second)
+
+	assert.NoError(t, firstErr)
+	assert.NoError(t, secondErr)
+	assert.Equal(t, []string{"hard", ""}, mockClient.refreshes)
+	assert.Nil(t, query.Refresh)
+}
+
+func TestAppPoller_Next_ReturnsGetError(t *testing.T) {
+	mockClient := &MockWatchClient{getErr: fmt.Errorf("testError")}
+	poller := NewAppPoller(mockClient, &application.ApplicationQuery{}, time.Millisecond, "", testLogger)
+
+	_, err := nextWithin(t, poller, time.Second)
+
+	assert.Error(t, err)
+	assert.Equal(t, "testError", err.Error())
+}
+
+func TestAppPoller_Next_StopsWaitingWhenContextIsDone(t *testing.T) {
+	mockClient := &MockWatchClient{apps: []*v1alpha1.Application{newApp("first")}}
+	poller := NewAppPoller(mockClient, &application.ApplicationQuery{}, time.Hour, "", testLogger)
+
+	_, _ = nextWithin(t, poller, time.Second)
+	_, err := nextWithin(t, poller, 10*time.Millisecond)
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	gets, _ := mockClient.counts()
+	assert.Equal(t, 1, gets)
+}
+
+func TestAppWatcher_Next_DeliversStreamEvents(t *testing.T) {
+	stream := &MockWatchStream{events: make(chan *v1alpha1.ApplicationWatchEvent), err: context.Canceled}
+	mockClient := &MockWatchClient{streams: []*MockWatchStream{stream}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer close(stream.events)
+	watcher := NewAppWatcher(ctx, mockClient, &application.ApplicationQuery{}, time.Hour, "", testLogger)
+
+	stream.events <- &v1alpha1.ApplicationWatchEvent{Type: watch.Added, Application: *newApp("first")}
+	first, firstErr := nextWithin(t, watcher, time.Second)
+	stream.events <- &v1alpha1.ApplicationWatchEvent{Type: watch.Deleted, Application: *newApp("deleted")}
+	stream.events <- &v1alpha1.ApplicationWatchEvent{Type: watch.Modified, Application: *newApp("second")}
+	second, secondErr := nextWithin(t, watcher, time.Second)
+
+	assert.NoError(t, firstErr)
+	assert.Equal(t, "first", first.Status.Sync.Revision)
+	assert.NoError(t, secondErr)
+	assert.Equal(t, "second", second.Status.Sync.Revision)
+	gets, watches := mockClient.counts()
+	assert.Equal(t, 0, gets)
+	assert.Equal(t, 1, watches)
+}
+
+func TestAppWatcher_Next_RedeliversLastStateAfterInterval(t *testing.T) {
+	stream := &MockWatchStream{events: make(chan *v1alpha1.ApplicationWatchEvent), err: context.Canceled}
+	mockClient := &MockWatchClient{streams: []*MockWatchStream{stream}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer close(stream.events)
+	watcher := NewAppWatcher(ctx, mockClient, &application.ApplicationQuery{}, 10*time.Millisecond, "", testLogger)
+
+	stream.events <- &v1alpha1.ApplicationWatchEvent{Type: watch.Added, Application: *newApp("first")}
+	first, firstErr := nextWithin(t, watcher, time.Second)
+	again, againErr := nextWithin(t, watcher, time.Second)
+
+	assert.NoError(t, firstErr)
+	assert.NoError(t, againErr)
+	assert.Same(t, first, again)
+	gets, _ := mockClient.counts()
+	assert.Equal(t, 0, gets)
+}
+
+func TestAppWatcher_Next_FallsBackToPollingAndResubscribesWhenStreamDrops(t *testing.T) {
+	mockClient := &MockWatchClient{
+		apps:            []*v1alpha1.Application{newApp("polled")},
+		appAfterStreams: newApp("resubscribed"),
+		streams: []*MockWatchStream{
+			newMockWatchStream(fmt.Errorf("stream reset"), newApp("watched")),
+			newMockWatchStream(fmt.Errorf("stream reset"), newApp("resubscribed")),
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	watcher := NewAppWatcher(ctx, mockClient, &application.ApplicationQuery{}, 10*time.Millisecond, "", testLogger)
+
+	// A state that is not picked up in time is replaced by the next one, so not every revision is observed
+	observed := map[string]bool{}
+	for deadline := time.Now().Add(5 * time.Second); !observed["resubscribed"] && time.Now().Before(deadline); {
+		app, err := nextWithin(t, watcher, time.Second)
+		if !assert.NoError(t, err) {
+			return
+		}
+		observed[app.Status.Sync.Revision] = true
+	}
+
+	assert.True(t, observed["resubscribed"])
+	assert.Subset(t, []string{"watched", "polled", "resubscribed"}, slices.Collect(maps.Keys(observed)))
+	gets, watches := mockClient.counts()
+	assert.GreaterOrEqual(t, gets, 1)
+	assert.GreaterOrEqual(t, watches, 2)
+}
+
+func TestAppWatcher_Next_PollsWhenWatchIsUnavailable(t *testing.T) {
+	mockClient := &MockWatchClient{
+		apps:     []*v1alpha1.Application{newApp("polled")},
+		watchErr: fmt.Errorf("watch not permitted"),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	watcher := NewAppWatcher(ctx, mockClient, &application.ApplicationQuery{}, 10*time.Millisecond, "", testLogger)
+
+	app, err := nextWithin(t, watcher, time.Second)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "polled", app.Status.Sync.Revision)
+}
+
+func TestAppWatcher_Next_RefreshesBeforeWatching(t *testing.T) {
+	mockClient := &MockWatchClient{apps: []*v1alpha1.Application{newApp("refreshed")}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	watcher := NewAppWatcher(ctx, mockClient, &application.ApplicationQuery{}, time.Hour, v1alpha1.RefreshTypeNormal, testLogger)
+
+	app, err := nextWithin(t, watcher, time.Second)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "refreshed", app.Status.Sync.Revision)
+	mockClient.mu.Lock()
+	defer mockClient.mu.Unlock()
+	assert.Equal(t, []string{"normal"}, mockClient.refreshes)
+}
+
+func TestAppWatcher_Next_StopsWaitingWhenContextIsDone(t *testing.T) {
+	mockClient := &MockWatchClient{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	watcher := NewAppWatcher(ctx, mockClient, &application.ApplicationQuery{}, time.Hour, "", testLogger)
+
+	_, err := nextWithin(t, watcher, 10*time.Millisecond)
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
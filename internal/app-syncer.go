@@ -0,0 +1,90 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"github.com/argoproj/argo-cd/v2/pkg/apiclient/application"
+	"github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	"google.golang.org/grpc"
+	"log/slog"
+	"time"
+)
+
+type ApplicationSyncClient interface {
+	ApplicationGetClient
+	Sync(ctx context.Context, in *application.ApplicationSyncRequest, opts ...grpc.CallOption) (*v1alpha1.Application, error)
+}
+
+// SyncSettings are the options of the sync operation that KPCEA triggers before verifying.
+type SyncSettings struct {
+	Revision string
+	Prune    bool
+	Force    bool
+	DryRun   bool
+}
+
+// AppSyncer triggers a sync of the Argo app and follows the resulting operation.
+type AppSyncer struct {
+	client   ApplicationSyncClient
+	app      AppRef
+	interval time.Duration
+	logger   *slog.Logger
+}
+
+func NewAppSyncer(client ApplicationSyncClient, app AppRef, interval time.Duration, logger *slog.Logger) *AppSyncer {
+	return &AppSyncer{
+		client:   client,
+		app:      app,
+		interval: interval,
+		logger:   logger,
+	}
+}
+
+// Sync requests a sync operation and waits until ArgoCD reports it as finished.
+// The finished operation state is returned, regardless of whether the operation succeeded.
+func (s *AppSyncer) Sync(ctx context.Context, settings SyncSettings) (*v1alpha1.OperationState, error) {
+	syncRequest := &application.ApplicationSyncRequest{
+		Name:         &s.app.Name,
+		AppNamespace: s.app.namespace(),
+		Project:      s.app.project(),
+		Prune:        &settings.Prune,
+		DryRun:       &settings.DryRun,
+		Strategy: &v1alpha1.SyncStrategy{
+			Hook: &v1alpha1.SyncStrategyHook{SyncStrategyApply: v1alpha1.SyncStrategyApply{Force: settings.Force}},
+		},
+	}
+	if settings.Revision != "" {
+		syncRequest.Revision = &settings.Revision
+	}
+	if _, err := s.client.Sync(ctx, syncRequest); err != nil {
+		return nil, fmt.Errorf("sync request not accepted by ArgoCD: %v", err)
+	}
+	s.logger.Info("Sync operation requested, waiting for it to finish")
+
+	appQuery := s.app.Query()
+	for {
+		argoApp, err := s.client.Get(ctx, appQuery)
+		if err != nil {
+			s.logger.Warn("Failed to fetch app details", "error", err)
+		} else if operationState := finishedOperation(argoApp); operationState != nil {
+			return operationState, nil
+		} else if argoApp.Status.OperationState != nil {
+			s.logger.Info("Sync operation in progress", "phase", argoApp.Status.OperationState.Phase)
+		}
+
+		if err = sleep(ctx, s.interval); err != nil {
+			return nil, fmt.Errorf("sync operation did not finish in time: %v", err)
+		}
+	}
+}
+
+// finishedOperation returns the operation state once the requested operation is no longer pending and has completed.
+func finishedOperation(argoApp *v1alpha1.Application) *v1alpha1.OperationState {
+	if argoApp.Operation != nil || argoApp.Status.OperationState == nil {
+		return nil
+	}
+	if !argoApp.Status.OperationState.Phase.Completed() {
+		return nil
+	}
+	return argoApp.Status.OperationState
+}
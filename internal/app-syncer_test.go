@@ -0,0 +1,110 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"github.com/argoproj/argo-cd/v2/pkg/apiclient/application"
+	"github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	synccommon "github.com/argoproj/gitops-engine/pkg/sync/common"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"testing"
+	"time"
+)
+
+type MockSyncClient struct {
+	MockWatchClient
+	syncRequest *application.ApplicationSyncRequest
+	syncErr     error
+}
+
+func (m *MockSyncClient) Sync(_ context.Context, in *application.ApplicationSyncRequest, _ ...grpc.CallOption) (*v1alpha1.Application, error) {
+	m.syncRequest = in
+	return nil, m.syncErr
+}
+
+func newOperationApp(pending bool, phase synccommon.OperationPhase, message string) *v1alpha1.Application {
+	app := &v1alpha1.Application{}
+	if pending {
+		app.Operation = &v1alpha1.Operation{Sync: &v1alpha1.SyncOperation{}}
+	}
+	if phase != "" {
+		app.Status.OperationState = &v1alpha1.OperationState{Phase: phase, Message: message}
+	}
+	return app
+}
+
+func TestAppSyncer_Sync_FollowsOperationUntilFinished(t *testing.T) {
+	mockClient := &MockSyncClient{MockWatchClient: MockWatchClient{apps: []*v1alpha1.Application{
+		newOperationApp(true, synccommon.OperationSucceeded, "previous sync"),
+		newOperationApp(false, synccommon.OperationRunning, ""),
+		newOperationApp(false, synccommon.OperationSucceeded, "successfully synced"),
+	}}}
+	syncer := NewAppSyncer(mockClient, AppRef{Name: "my-app", Namespace: "team-payments", Project: "payments"}, time.Millisecond, testLogger)
+
+	operationState, err := syncer.Sync(context.Background(), SyncSettings{Revision: "abc123", Prune: true, Force: true})
+
+	assert.NoError(t, err)
+	assert.Equal(t, synccommon.OperationSucceeded, operationState.Phase)
+	assert.Equal(t, "successfully synced", operationState.Message)
+	gets, _ := mockClient.counts()
+	assert.Equal(t, 3, gets)
+	assert.Equal(t, "my-app", mockClient.syncRequest.GetName())
+	assert.Equal(t, "team-payments", mockClient.syncRequest.GetAppNamespace())
+	assert.Equal(t, "payments", mockClient.syncRequest.GetProject())
+	assert.Equal(t, "abc123", mockClient.syncRequest.GetRevision())
+	assert.True(t, mockClient.syncRequest.GetPrune())
+	assert.False(t, mockClient.syncRequest.GetDryRun())
+	assert.True(t, mockClient.syncRequest.Strategy.Force())
+}
+
+func TestAppSyncer_Sync_WithoutRevision(t *testing.T) {
+	mockClient := &MockSyncClient{MockWatchClient: MockWatchClient{apps: []*v1alpha1.Application{
+		newOperationApp(false, synccommon.OperationSucceeded, ""),
+	}}}
+	syncer := NewAppSyncer(mockClient, AppRef{Name: "my-app"}, time.Millisecond, testLogger)
+
+	_, err := syncer.Sync(context.Background(), SyncSettings{DryRun: true})
+
+	assert.NoError(t, err)
+	assert.Nil(t, mockClient.syncRequest.Revision)
+	assert.True(t, mockClient.syncRequest.GetDryRun())
+	assert.False(t, mockClient.syncRequest.Strategy.Force())
+}
+
+func TestAppSyncer_Sync_ReturnsFailedOperation(t *testing.T) {
+	mockClient := &MockSyncClient{MockWatchClient: MockWatchClient{apps: []*v1alpha1.Application{
+		newOperationApp(false, synccommon.OperationFailed, "one or more objects failed to apply"),
+	}}}
+	syncer := NewAppSyncer(mockClient, AppRef{Name: "my-app"}, time.Millisecond, testLogger)
+
+	operationState, err := syncer.Sync(context.Background(), SyncSettings{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, synccommon.OperationFailed, operationState.Phase)
+	assert.Equal(t, "one or more objects failed to apply", operationState.Message)
+}
+
+func TestAppSyncer_Sync_RejectedByArgo(t *testing.T) {
+	mockClient := &MockSyncClient{syncErr: fmt.Errorf("permission denied")}
+	syncer := NewAppSyncer(mockClient, AppRef{Name: "my-app"}, time.Millisecond, testLogger)
+
+	_, err := syncer.Sync(context.Background(), SyncSettings{})
+
+	assert.Error(t, err)
+	assert.Equal(t, "sync request not accepted by ArgoCD: permission denied", err.Error())
+}
+
+func TestAppSyncer_Sync_OperationDoesNotFinishInTime(t *testing.T) {
+	mockClient := &MockSyncClient{MockWatchClient: MockWatchClient{apps: []*v1alpha1.Application{
+		newOperationApp(false, synccommon.OperationRunning, ""),
+	}}}
+	syncer := NewAppSyncer(mockClient, AppRef{Name: "my-app"}, time.Millisecond, testLogger)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	_, err := syncer.Sync(ctx, SyncSettings{})
+
+	assert.Error(t, err)
+	assert.Equal(t, "sync operation did not finish in time: context deadline exceeded", err.Error())
+}
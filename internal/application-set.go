@@ -0,0 +1,36 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"github.com/argoproj/argo-cd/v2/pkg/apiclient/applicationset"
+	"github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	"google.golang.org/grpc"
+)
+
+type ApplicationSetGetClient interface {
+	Get(ctx context.Context, in *applicationset.ApplicationSetGetQuery, opts ...grpc.CallOption) (*v1alpha1.ApplicationSet, error)
+}
+
+// GeneratedApps returns the Argo apps that the ApplicationSet currently generates.
+// An empty set is an error, and so is a set that differs from the expected count when one is given.
+func GeneratedApps(ctx context.Context, client ApplicationSetGetClient, appSet AppRef, expectedCount int) ([]AppRef, error) {
+	argoAppSet, err := client.Get(ctx, &applicationset.ApplicationSetGetQuery{Name: appSet.Name, AppsetNamespace: appSet.Namespace})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get ApplicationSet '%s': %v", appSet, err)
+	}
+
+	var apps []AppRef
+	for _, resource := range argoAppSet.Status.Resources {
+		if resource.Kind == "Application" {
+			apps = append(apps, AppRef{Name: resource.Name, Namespace: resource.Namespace, Project: appSet.Project})
+		}
+	}
+	if len(apps) == 0 {
+		return nil, fmt.Errorf("ApplicationSet '%s' does not generate any apps", appSet)
+	}
+	if expectedCount > 0 && len(apps) != expectedCount {
+		return nil, fmt.Errorf("ApplicationSet '%s' generates %d apps, expected %d", appSet, len(apps), expectedCount)
+	}
+	return apps, nil
+}
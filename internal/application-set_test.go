@@ -0,0 +1,82 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"github.com/argoproj/argo-cd/v2/pkg/apiclient/applicationset"
+	"github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"testing"
+)
+
+type MockAppSetClient struct {
+	AppSet  *v1alpha1.ApplicationSet
+	GetErr  error
+	Queried string
+}
+
+func (m *MockAppSetClient) Get(_ context.Context, in *applicationset.ApplicationSetGetQuery, _ ...grpc.CallOption) (*v1alpha1.ApplicationSet, error) {
+	m.Queried = in.AppsetNamespace + "/" + in.Name
+	return m.AppSet, m.GetErr
+}
+
+func newAppSet(resources ...v1alpha1.ResourceStatus) *v1alpha1.ApplicationSet {
+	appSet := &v1alpha1.ApplicationSet{}
+	appSet.Status.Resources = resources
+	return appSet
+}
+
+func TestGeneratedApps(t *testing.T) {
+	client := &MockAppSetClient{AppSet: newAppSet(
+		v1alpha1.ResourceStatus{Kind: "Application", Name: "api-eu-west", Namespace: "team-api"},
+		v1alpha1.ResourceStatus{Kind: "Application", Name: "api-us-east", Namespace: "team-api"},
+		v1alpha1.ResourceStatus{Kind: "ConfigMap", Name: "unrelated"},
+	)}
+
+	apps, err := GeneratedApps(context.Background(), client, AppRef{Name: "api"}, 0)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "/api", client.Queried)
+	assert.Equal(t, []AppRef{{Name: "api-eu-west", Namespace: "team-api"}, {Name: "api-us-east", Namespace: "team-api"}}, apps)
+}
+
+func TestGeneratedApps_ExpectedCount(t *testing.T) {
+	client := &MockAppSetClient{AppSet: newAppSet(
+		v1alpha1.ResourceStatus{Kind: "Application", Name: "api-eu-west"},
+		v1alpha1.ResourceStatus{Kind: "Application", Name: "api-us-east"},
+	)}
+
+	apps, matchErr := GeneratedApps(context.Background(), client, AppRef{Name: "api"}, 2)
+	_, mismatchErr := GeneratedApps(context.Background(), client, AppRef{Name: "api"}, 3)
+
+	assert.NoError(t, matchErr)
+	assert.Len(t, apps, 2)
+	assert.EqualError(t, mismatchErr, "ApplicationSet 'api' generates 2 apps, expected 3")
+}
+
+func TestGeneratedApps_AppSetInNamespace(t *testing.T) {
+	client := &MockAppSetClient{AppSet: newAppSet(v1alpha1.ResourceStatus{Kind: "Application", Name: "api-eu-west", Namespace: "team-api"})}
+
+	apps, err := GeneratedApps(context.Background(), client, AppRef{Name: "api", Namespace: "team-api", Project: "payments"}, 0)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "team-api/api", client.Queried)
+	assert.Equal(t, []AppRef{{Name: "api-eu-west", Namespace: "team-api", Project: "payments"}}, apps)
+}
+
+func TestGeneratedApps_EmptySet(t *testing.T) {
+	client := &MockAppSetClient{AppSet: newAppSet()}
+
+	_, err := GeneratedApps(context.Background(), client, AppRef{Name: "api"}, 0)
+
+	assert.EqualError(t, err, "ApplicationSet 'api' does not generate any apps")
+}
+
+func TestGeneratedApps_GetFails(t *testing.T) {
+	client := &MockAppSetClient{GetErr: fmt.Errorf("permission denied")}
+
+	_, err := GeneratedApps(context.Background(), client, AppRef{Name: "api"}, 0)
+
+	assert.EqualError(t, err, "unable to get ApplicationSet 'api': permission denied")
+}
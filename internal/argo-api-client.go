@@ -2,9 +2,11 @@ package internal
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 )
 
@@ -13,16 +15,18 @@ type HTTPClient interface {
 }
 
 type ArgoApiLoginInterface interface {
-	GetApiToken(username string, password string) (string, error)
+	GetApiToken(ctx context.Context, argoServer string, apiUsername string, apiPassword string, plainText bool) (string, error)
 }
 
 type ArgoLoginClient struct {
 	client HTTPClient
+	logger *slog.Logger
 }
 
-func NewArgoLoginClient(client HTTPClient) *ArgoLoginClient {
+func NewArgoLoginClient(client HTTPClient, logger *slog.Logger) *ArgoLoginClient {
 	return &ArgoLoginClient{
 		client: client,
+		logger: logger,
 	}
 }
 
@@ -30,26 +34,32 @@ type LoginResponse struct {
 	AuthToken string `json:"token"`
 }
 
-func (c *ArgoLoginClient) GetApiToken(argoServer string, apiUsername string, apiPassword string, allowInsecure bool) (string, error) {
+// LoginErrorResponse is returned by ArgoCD when the token request is not accepted.
+type LoginErrorResponse struct {
+	Message string `json:"message"`
+}
+
+// GetApiToken requests a session token from ArgoCD. The argoServer may include the base path of ArgoCD, e.g. tools.corp.example/argocd.
+func (c *ArgoLoginClient) GetApiToken(ctx context.Context, argoServer string, apiUsername string, apiPassword string, plainText bool) (string, error) {
 	loginPostData := map[string]string{
 		"username": apiUsername,
 		"password": apiPassword,
 	}
 	loginJsonData, err := json.Marshal(loginPostData)
 	if err != nil {
-		fmt.Println("Error encoding JSON:", err)
+		c.logger.Error("Error encoding JSON", "error", err)
 		return "", err
 	}
 
 	// Create HTTP POST request
 	protocol := "https"
-	if allowInsecure {
+	if plainText {
 		protocol = "http"
 	}
 	argoLoginUrl := fmt.Sprintf("%s://%s/api/v1/session", protocol, argoServer)
-	req, err := http.NewRequest("POST", argoLoginUrl, bytes.NewBuffer(loginJsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", argoLoginUrl, bytes.NewBuffer(loginJsonData))
 	if err != nil {
-		fmt.Println("Error creating request:", err)
+		c.logger.Error("Error creating request", "error", err)
 		return "", err
 	}
 	req.Header.Set("Content-Type", "application/json")
@@ -57,20 +67,24 @@ func (c *ArgoLoginClient) GetApiToken(argoServer string, apiUsername string, api
 	// Execute the request
 	resp, err := c.client.Do(req)
 	if err != nil {
-		fmt.Println("Error making request:", err)
+		c.logger.Error("Error making request", "error", err)
 		return "", err
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		fmt.Println("Error reading response:", err)
+		c.logger.Error("Error reading response", "error", err)
 		return "", err
 	}
 
 	if resp.StatusCode != 200 {
-		// TODO: Handle errors from ArgoCD API e.g. {"error":"Invalid username or password","code":16,"message":"Invalid username or password"}
-		fmt.Println(string(body))
+		// Only log the message of the error, the raw response body is not logged
+		var errorResp LoginErrorResponse
+		if json.Unmarshal(body, &errorResp) != nil {
+			errorResp.Message = "unknown error"
+		}
+		c.logger.Error("Token request not accepted by ArgoCD", "status", resp.StatusCode, "message", errorResp.Message)
 		return "", fmt.Errorf("token request not accepted by ArgoCD (http %d)", resp.StatusCode)
 	}
 
@@ -78,12 +92,12 @@ func (c *ArgoLoginClient) GetApiToken(argoServer string, apiUsername string, api
 	var loginResp LoginResponse
 	err = json.Unmarshal(body, &loginResp)
 	if err != nil {
-		fmt.Println("Error decoding JSON:", err)
+		c.logger.Error("Error decoding JSON", "error", err)
 		return "", err
 	}
 
 	if loginResp.AuthToken == "" {
-		fmt.Println("Unable to get API token from ArgoCD")
+		c.logger.Error("Unable to get API token from ArgoCD")
 		return "", fmt.Errorf("unable to get API token from ArgoCD")
 	}
 
@@ -1,20 +1,25 @@
 package internal
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"github.com/stretchr/testify/assert"
 	"io"
+	"log/slog"
 	"net/http"
 	"strings"
 	"testing"
 )
 
 type MockHTTPClient struct {
+	Req  *http.Request
 	Resp *http.Response
 	Err  error
 }
 
 func (m *MockHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	m.Req = req
 	return m.Resp, m.Err
 }
 
@@ -35,9 +40,9 @@ func NewMockHTTPClient(statusCode int, hasResponse bool, responseBody string, er
 
 func TestArgoLoginClient_GetApiToken(t *testing.T) {
 	mockClient := NewMockHTTPClient(200, true, `{"token": "mock-token"}`, nil)
-	argoClient := NewArgoLoginClient(mockClient)
+	argoClient := NewArgoLoginClient(mockClient, testLogger)
 
-	token, err := argoClient.GetApiToken("myServer", "myUser", "myPass", false)
+	token, err := argoClient.GetApiToken(context.Background(), "myServer", "myUser", "myPass", false)
 
 	assert.NoError(t, err)
 	assert.Equal(t, "mock-token", token)
@@ -45,30 +50,52 @@ func TestArgoLoginClient_GetApiToken(t *testing.T) {
 
 func TestArgoLoginClient_GetApiToken_Insecure(t *testing.T) {
 	mockClient := NewMockHTTPClient(200, true, `{"token": "mock-token"}`, nil)
-	argoClient := NewArgoLoginClient(mockClient)
+	argoClient := NewArgoLoginClient(mockClient, testLogger)
 
-	token, err := argoClient.GetApiToken("myServer", "myUser", "myPass", true)
+	token, err := argoClient.GetApiToken(context.Background(), "myServer", "myUser", "myPass", true)
 
 	assert.NoError(t, err)
 	assert.Equal(t, "mock-token", token)
 }
 
+func TestArgoLoginClient_GetApiToken_BasePath(t *testing.T) {
+	mockClient := NewMockHTTPClient(200, true, `{"token": "mock-token"}`, nil)
+	argoClient := NewArgoLoginClient(mockClient, testLogger)
+
+	_, err := argoClient.GetApiToken(context.Background(), "tools.corp.example/argocd", "myUser", "myPass", false)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "https://tools.corp.example/argocd/api/v1/session", mockClient.Req.URL.String())
+}
+
 func TestArgoLoginClient_GetApiToken_FailedHttpRequest(t *testing.T) {
 	mockClient := NewMockHTTPClient(401, true, `{"error":"Invalid username or password","code":16,"message":"Invalid username or password"}`, nil)
-	argoClient := NewArgoLoginClient(mockClient)
+	argoClient := NewArgoLoginClient(mockClient, testLogger)
 
-	_, err := argoClient.GetApiToken("myServer", "myUser", "myPass", true)
+	_, err := argoClient.GetApiToken(context.Background(), "myServer", "myUser", "myPass", true)
 
 	assert.Error(t, err)
 	assert.Equal(t, "token request not accepted by ArgoCD (http 401)", err.Error())
 }
 
+func TestArgoLoginClient_GetApiToken_FailedHttpRequestLogsOnlyMessage(t *testing.T) {
+	var output bytes.Buffer
+	mockClient := NewMockHTTPClient(401, true, `{"error":"Invalid username or password","code":16,"message":"Invalid username or password"}`, nil)
+	argoClient := NewArgoLoginClient(mockClient, NewLogger(&output, TextLog, slog.LevelInfo, NewRedactor("myPass")))
+
+	_, err := argoClient.GetApiToken(context.Background(), "myServer", "myUser", "myPass", true)
+
+	assert.Error(t, err)
+	assert.Contains(t, output.String(), `msg="Token request not accepted by ArgoCD" status=401 message="Invalid username or password"`)
+	assert.NotContains(t, output.String(), "code")
+}
+
 func TestArgoLoginClient_GetApiToken_EmptyToken(t *testing.T) {
 	mockClient := NewMockHTTPClient(200, true, `{"token": ""}`, nil)
 
-	argoClient := NewArgoLoginClient(mockClient)
+	argoClient := NewArgoLoginClient(mockClient, testLogger)
 
-	_, err := argoClient.GetApiToken("myServer", "myUser", "myPass", true)
+	_, err := argoClient.GetApiToken(context.Background(), "myServer", "myUser", "myPass", true)
 
 	assert.Error(t, err)
 	assert.Equal(t, "unable to get API token from ArgoCD", err.Error())
@@ -76,9 +103,9 @@ func TestArgoLoginClient_GetApiToken_EmptyToken(t *testing.T) {
 
 func TestArgoLoginClient_GetApiToken_UnableToCreateRequest(t *testing.T) {
 	mockClient := NewMockHTTPClient(0, false, "", nil)
-	argoClient := NewArgoLoginClient(mockClient)
+	argoClient := NewArgoLoginClient(mockClient, testLogger)
 
-	_, err := argoClient.GetApiToken("\t", "myUser", "myPass", true)
+	_, err := argoClient.GetApiToken(context.Background(), "\t", "myUser", "myPass", true)
 
 	assert.Error(t, err)
 	assert.Equal(t, `parse "http://\t/api/v1/session": net/url: invalid control character in URL`, err.Error())
@@ -86,9 +113,9 @@ func TestArgoLoginClient_GetApiToken_UnableToCreateRequest(t *testing.T) {
 
 func TestArgoLoginClient_GetApiToken_HttpClientError(t *testing.T) {
 	mockClient := NewMockHTTPClient(0, false, "", fmt.Errorf("testError"))
-	argoClient := NewArgoLoginClient(mockClient)
+	argoClient := NewArgoLoginClient(mockClient, testLogger)
 
-	_, err := argoClient.GetApiToken("argoServer", "myUser", "myPass", true)
+	_, err := argoClient.GetApiToken(context.Background(), "argoServer", "myUser", "myPass", true)
 
 	assert.Error(t, err)
 	assert.Equal(t, "testError", err.Error())
@@ -96,9 +123,9 @@ func TestArgoLoginClient_GetApiToken_HttpClientError(t *testing.T) {
 
 func TestArgoLoginClient_GetApiToken_ResponseBodyIsNotJson(t *testing.T) {
 	mockClient := NewMockHTTPClient(200, true, "", nil)
-	argoClient := NewArgoLoginClient(mockClient)
+	argoClient := NewArgoLoginClient(mockClient, testLogger)
 
-	_, err := argoClient.GetApiToken("argoServer", "myUser", "myPass", true)
+	_, err := argoClient.GetApiToken(context.Background(), "argoServer", "myUser", "myPass", true)
 
 	assert.Error(t, err)
 	assert.Equal(t, "unexpected end of JSON input", err.Error())
@@ -106,9 +133,9 @@ func TestArgoLoginClient_GetApiToken_ResponseBodyIsNotJson(t *testing.T) {
 
 func TestArgoLoginClient_GetApiToken_ResponseBodyHasNoToken(t *testing.T) {
 	mockClient := NewMockHTTPClient(200, true, `{"notToken": ""}`, nil)
-	argoClient := NewArgoLoginClient(mockClient)
+	argoClient := NewArgoLoginClient(mockClient, testLogger)
 
-	_, err := argoClient.GetApiToken("argoServer", "myUser", "myPass", true)
+	_, err := argoClient.GetApiToken(context.Background(), "argoServer", "myUser", "myPass", true)
 
 	assert.Error(t, err)
 	assert.Equal(t, "unable to get API token from ArgoCD", err.Error())
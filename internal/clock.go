@@ -0,0 +1,6 @@
+package internal
+
+import "time"
+
+// Clock returns the current time. Tests replace it to control how much time has passed.
+type Clock func() time.Time
@@ -0,0 +1,34 @@
+package internal
+
+import (
+	"regexp"
+	"strings"
+)
+
+// MatchCommitMessage checks the commit message against the configured verification mode.
+// For REGEX_COMMIT_MSG mode, the values of any named groups in the pattern are returned as well.
+func MatchCommitMessage(config *Config, message string) (bool, map[string]string) {
+	if config.VerifyMode == RegexCommitMessage {
+		return matchCommitMessageRegex(config.CommitMessageRegex, message)
+	}
+	return strings.Contains(message, config.SearchCommitMessage), nil
+}
+
+func matchCommitMessageRegex(pattern *regexp.Regexp, message string) (bool, map[string]string) {
+	if pattern == nil {
+		return false, nil
+	}
+	matches := pattern.FindStringSubmatch(message)
+	if matches == nil {
+		return false, nil
+	}
+
+	groups := make(map[string]string)
+	for i, name := range pattern.SubexpNames() {
+		if i == 0 || name == "" {
+			continue
+		}
+		groups[name] = matches[i]
+	}
+	return true, groups
+}
@@ -0,0 +1,82 @@
+package internal
+
+import (
+	"github.com/stretchr/testify/assert"
+	"regexp"
+	"testing"
+)
+
+const kargoCommitMessage = "Promote freight abc123 to stage uat (2 images)"
+
+func TestMatchCommitMessage_SearchModeContainsValue(t *testing.T) {
+	config := &Config{VerifyMode: SearchCommitMessage, SearchCommitMessage: "stage uat"}
+
+	match, groups := MatchCommitMessage(config, kargoCommitMessage)
+
+	assert.True(t, match)
+	assert.Nil(t, groups)
+}
+
+func TestMatchCommitMessage_SearchModeDoesNotContainValue(t *testing.T) {
+	config := &Config{VerifyMode: SearchCommitMessage, SearchCommitMessage: "stage prod"}
+
+	match, _ := MatchCommitMessage(config, kargoCommitMessage)
+
+	assert.False(t, match)
+}
+
+func TestMatchCommitMessage_RegexModeMatches(t *testing.T) {
+	config := &Config{
+		VerifyMode:         RegexCommitMessage,
+		CommitMessageRegex: regexp.MustCompile(`^Promote freight \w+ to stage uat \(`),
+	}
+
+	match, groups := MatchCommitMessage(config, kargoCommitMessage)
+
+	assert.True(t, match)
+	assert.Empty(t, groups)
+}
+
+func TestMatchCommitMessage_RegexModeAnchorsRejectSimilarStage(t *testing.T) {
+	config := &Config{
+		VerifyMode:         RegexCommitMessage,
+		CommitMessageRegex: regexp.MustCompile(`to stage uat \(`),
+	}
+
+	match, groups := MatchCommitMessage(config, "Promote freight abc123 to stage uat-eu (2 images)")
+
+	assert.False(t, match)
+	assert.Nil(t, groups)
+}
+
+func TestMatchCommitMessage_RegexModeReturnsNamedGroups(t *testing.T) {
+	config := &Config{
+		VerifyMode:         RegexCommitMessage,
+		CommitMessageRegex: regexp.MustCompile(`^Promote freight (?P<freight>\w+) to stage (?P<stage>[\w-]+) \((\d+) images\)$`),
+	}
+
+	match, groups := MatchCommitMessage(config, kargoCommitMessage)
+
+	assert.True(t, match)
+	assert.Equal(t, map[string]string{"freight": "abc123", "stage": "uat"}, groups)
+}
+
+func TestMatchCommitMessage_RegexModeCaseInsensitive(t *testing.T) {
+	config := &Config{
+		VerifyMode:         RegexCommitMessage,
+		CommitMessageRegex: regexp.MustCompile(`(?i)promote FREIGHT`),
+	}
+
+	match, _ := MatchCommitMessage(config, kargoCommitMessage)
+
+	assert.True(t, match)
+}
+
+func TestMatchCommitMessage_RegexModeWithoutPattern(t *testing.T) {
+	config := &Config{VerifyMode: RegexCommitMessage}
+
+	match, groups := MatchCommitMessage(config, kargoCommitMessage)
+
+	assert.False(t, match)
+	assert.Nil(t, groups)
+}
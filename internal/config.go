@@ -1,85 +1,238 @@
 package internal
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"github.com/Masterminds/semver/v3"
+	"github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	"log/slog"
+	"net/url"
 	"os"
+	"regexp"
 	"strconv"
+	"strings"
 	"time"
 )
 
 type AuthMode string
 type VerificationMode string
+type WaitMode string
+type OutputFormat string
+type LogFormat string
 
 const (
 	LoginMode           AuthMode         = "LOGIN"
 	TokenMode           AuthMode         = "TOKEN"
 	Exact               VerificationMode = "EXACT"
 	SearchCommitMessage VerificationMode = "SEARCH_COMMIT_MSG"
+	RegexCommitMessage  VerificationMode = "REGEX_COMMIT_MSG"
+	Images              VerificationMode = "IMAGES"
+	HelmChartVersion    VerificationMode = "HELM_CHART_VERSION"
+	PollWait            WaitMode         = "POLL"
+	WatchWait           WaitMode         = "WATCH"
+	TextOutput          OutputFormat     = "text"
+	JsonOutput          OutputFormat     = "json"
+	TextLog             LogFormat        = "text"
+	JsonLog             LogFormat        = "json"
 )
 
 type Config struct {
 	ArgoServer          string
+	ArgoBasePath        string
 	ArgoApiToken        string
+	ArgoApiTokenFile    string
 	ArgoAppName         string
+	ArgoAppNames        []string
+	ArgoAppNamespace    string
+	ArgoAppProject      string
+	AppSelector         string
+	AppSetName          string
+	ExpectedAppCount    int
 	ApiUsername         string
 	ApiPassword         string
 	AuthMode            AuthMode
 	TargetRevision      string
+	TargetRevisions     []SourceRevision
 	SearchCommitMessage string
+	CommitMessageRegex  *regexp.Regexp
+	ExpectedImages      []ExpectedImage
+	ChartVersion        *semver.Constraints
+	ChartName           string
 	PollTimeout         time.Duration
 	PollInterval        time.Duration
-	AllowInsecure       bool
+	FailureGracePeriod  time.Duration
+	StableFor           time.Duration
+	PlainText           bool
+	TLSSkipVerify       bool
+	UseGRPC             bool
+	GRPCWebRootPath     string
+	CAFile              string
+	ClientCertFile      string
+	ClientKeyFile       string
+	ResolveRevision     bool
+	WaitMode            WaitMode
+	Refresh             v1alpha1.RefreshType
+	TriggerSync         bool
+	SyncPrune           bool
+	SyncForce           bool
+	SyncDryRun          bool
+	Output              OutputFormat
+	LogFormat           LogFormat
+	LogLevel            slog.Level
+	ListenAddress       string
 	VerifyMode          VerificationMode
 }
 
 // LoadConfig reads environment variables and initializes the configuration
 func LoadConfig() (*Config, error) {
-	argoServer, hasServer := os.LookupEnv("ARGOCD_SERVER")
-	argoAppName, hasAppName := os.LookupEnv("ARGOCD_APP_NAME")
+	return loadConfig(os.LookupEnv, true, true)
+}
+
+// LoadServerConfig reads the environment variables for serve mode.
+// The app and the verification settings are optional, since they are provided per check.
+func LoadServerConfig() (*Config, error) {
+	return loadConfig(os.LookupEnv, false, true)
+}
+
+// LoadCheckConfig reads the configuration of a single check in serve mode.
+// The query parameters of the check take precedence over the environment variables.
+// The credentials are not read, since the check uses the clients of the server, which reload the token themselves.
+func LoadCheckConfig(params url.Values) (*Config, error) {
+	return loadConfig(checkParamsLookup(params), true, false)
+}
 
-	// Ensure mandatory fields are present
-	if !hasServer || !hasAppName || argoServer == "" || argoAppName == "" {
+func loadConfig(lookup LookupFunc, requireCheck bool, requireAuth bool) (*Config, error) {
+	argoServer, hasServer := lookup("ARGOCD_SERVER")
+	argoAppName, hasAppName := lookup("ARGOCD_APP_NAME")
+	appSelector := lookup.get("KPCEA_APP_SELECTOR")
+	appSetName := lookup.get("ARGOCD_APPSET_NAME")
+
+	// Ensure mandatory fields are present, apps can be selected by name, by label selector or by ApplicationSet
+	hasApps := (hasAppName && argoAppName != "") || appSelector != "" || appSetName != ""
+	if !hasServer || argoServer == "" || (requireCheck && !hasApps) {
 		return nil, fmt.Errorf("ARGOCD_SERVER and ARGOCD_APP_NAME must be set")
 	}
+	argoServer, argoBasePath, serverScheme, serverErr := parseArgoServer(argoServer)
+	if serverErr != nil {
+		return nil, serverErr
+	}
+	var argoAppNames []string
+	for _, appName := range strings.Split(argoAppName, ",") {
+		if appName = strings.TrimSpace(appName); appName != "" {
+			argoAppNames = append(argoAppNames, appName)
+		}
+	}
 
 	// Determine verify mode
-	verifyMode, hasVerifyMode := os.LookupEnv("KPCEA_VERIFY_MODE")
+	verifyMode, hasVerifyMode := lookup("KPCEA_VERIFY_MODE")
 	var verificationMode VerificationMode
 	if !hasVerifyMode {
 		verificationMode = Exact
 	} else {
-		if verifyMode == "SEARCH_COMMIT_MSG" {
+		switch verifyMode {
+		case "SEARCH_COMMIT_MSG":
 			verificationMode = SearchCommitMessage
-		} else {
+		case "REGEX_COMMIT_MSG":
+			verificationMode = RegexCommitMessage
+		case "IMAGES":
+			verificationMode = Images
+		case "HELM_CHART_VERSION":
+			verificationMode = HelmChartVersion
+		default:
 			verificationMode = Exact
 		}
 	}
 
-	targetRevision, hasTargetRevision := os.LookupEnv("KPCEA_TARGET_REVISION")
-	if verificationMode == Exact && (!hasTargetRevision || targetRevision == "") {
-		return nil, fmt.Errorf("KPCEA_TARGET_REVISION must be set for verification mode EXACT")
+	targetRevision, hasTargetRevision := lookup("KPCEA_TARGET_REVISION")
+	targetRevisionsValue, hasTargetRevisions := lookup("KPCEA_TARGET_REVISIONS")
+	hasTargetRevision = hasTargetRevision && targetRevision != ""
+	hasTargetRevisions = hasTargetRevisions && targetRevisionsValue != ""
+	if requireCheck && verificationMode == Exact && !hasTargetRevision && !hasTargetRevisions {
+		return nil, fmt.Errorf("KPCEA_TARGET_REVISION or KPCEA_TARGET_REVISIONS must be set for verification mode EXACT")
+	}
+	var targetRevisions []SourceRevision
+	if verificationMode == Exact && hasTargetRevisions {
+		parsed, revisionsErr := ParseTargetRevisions(targetRevisionsValue)
+		if revisionsErr != nil {
+			return nil, fmt.Errorf("provided KPCEA_TARGET_REVISIONS is invalid: %v", revisionsErr)
+		}
+		targetRevisions = parsed
 	}
-	searchCommitMessage, hasSearchCommitMsg := os.LookupEnv("KPCEA_SEARCH_COMMIT_MSG")
-	if verificationMode == SearchCommitMessage && (!hasSearchCommitMsg || searchCommitMessage == "") {
+	searchCommitMessage, hasSearchCommitMsg := lookup("KPCEA_SEARCH_COMMIT_MSG")
+	if requireCheck && verificationMode == SearchCommitMessage && (!hasSearchCommitMsg || searchCommitMessage == "") {
 		return nil, fmt.Errorf("KPCEA_SEARCH_COMMIT_MSG must be set for verification mode SEARCH_COMMIT_MSG")
 	}
+	commitMessageRegex, hasCommitMsgRegex := lookup("KPCEA_COMMIT_MSG_REGEX")
+	var compiledCommitMessageRegex *regexp.Regexp
+	if verificationMode == RegexCommitMessage && (requireCheck || hasCommitMsgRegex) {
+		if !hasCommitMsgRegex || commitMessageRegex == "" {
+			return nil, fmt.Errorf("KPCEA_COMMIT_MSG_REGEX must be set for verification mode REGEX_COMMIT_MSG")
+		}
+		// Compile upfront so a bad pattern fails before polling starts
+		compiled, regexErr := regexp.Compile(commitMessageRegex)
+		if regexErr != nil {
+			return nil, fmt.Errorf("provided KPCEA_COMMIT_MSG_REGEX is not a valid regular expression: %v", regexErr)
+		}
+		compiledCommitMessageRegex = compiled
+	}
+	expectedImagesValue, hasExpectedImages := lookup("KPCEA_EXPECTED_IMAGES")
+	var expectedImages []ExpectedImage
+	if verificationMode == Images && (requireCheck || hasExpectedImages) {
+		if !hasExpectedImages || expectedImagesValue == "" {
+			return nil, fmt.Errorf("KPCEA_EXPECTED_IMAGES must be set for verification mode IMAGES")
+		}
+		parsed, imagesErr := ParseExpectedImages(expectedImagesValue)
+		if imagesErr != nil {
+			return nil, fmt.Errorf("provided KPCEA_EXPECTED_IMAGES is invalid: %v", imagesErr)
+		}
+		expectedImages = parsed
+	}
+	chartVersionValue, hasChartVersion := lookup("KPCEA_CHART_VERSION")
+	var chartVersion *semver.Constraints
+	if verificationMode == HelmChartVersion && (requireCheck || hasChartVersion) {
+		if !hasChartVersion || chartVersionValue == "" {
+			return nil, fmt.Errorf("KPCEA_CHART_VERSION must be set for verification mode HELM_CHART_VERSION")
+		}
+		parsed, constraintErr := semver.NewConstraint(chartVersionValue)
+		if constraintErr != nil {
+			return nil, fmt.Errorf("provided KPCEA_CHART_VERSION is not a valid semver constraint: %v", constraintErr)
+		}
+		chartVersion = parsed
+	}
+	chartName := lookup.get("KPCEA_CHART_NAME")
 
-	argoApiToken, hasToken := os.LookupEnv("ARGOCD_API_TOKEN")
-	apiUsername, hasUsername := os.LookupEnv("ARGOCD_API_USERNAME")
-	apiPassword, hasPassword := os.LookupEnv("ARGOCD_API_PASSWORD")
-	// Determine authentication mode
+	var argoApiToken, argoApiTokenFile, apiUsername, apiPassword string
 	var authMode AuthMode
-	if hasToken && argoApiToken != "" {
-		authMode = TokenMode
-	} else {
-		if !hasUsername || !hasPassword || apiUsername == "" || apiPassword == "" {
-			return nil, fmt.Errorf("ARGOCD_API_USERNAME and ARGOCD_API_PASSWORD must be set for LOGIN mode")
+	if requireAuth {
+		var hasToken, hasUsername, hasPassword bool
+		argoApiToken, hasToken = lookup("ARGOCD_API_TOKEN")
+		argoApiTokenFile = lookup.get("ARGOCD_API_TOKEN_FILE")
+		if (!hasToken || argoApiToken == "") && argoApiTokenFile != "" {
+			// Token is mounted as a file instead of an env var
+			fileToken, tokenFileErr := ReadTokenFile(argoApiTokenFile)
+			if tokenFileErr != nil {
+				return nil, fmt.Errorf("provided ARGOCD_API_TOKEN_FILE can not be read: %v", tokenFileErr)
+			}
+			argoApiToken, hasToken = fileToken, true
+		} else {
+			argoApiTokenFile = ""
+		}
+		apiUsername, hasUsername = lookup("ARGOCD_API_USERNAME")
+		apiPassword, hasPassword = lookup("ARGOCD_API_PASSWORD")
+		// Determine authentication mode
+		if hasToken && argoApiToken != "" {
+			authMode = TokenMode
+		} else {
+			if !hasUsername || !hasPassword || apiUsername == "" || apiPassword == "" {
+				return nil, fmt.Errorf("ARGOCD_API_USERNAME and ARGOCD_API_PASSWORD must be set for LOGIN mode")
+			}
+			authMode = LoginMode
 		}
-		authMode = LoginMode
 	}
 
 	// Other (optional) configuration
-	timeout, hasTimeout := os.LookupEnv("KPCEA_TIMEOUT")
+	timeout, hasTimeout := lookup("KPCEA_TIMEOUT")
 	if !hasTimeout {
 		timeout = "30"
 	}
@@ -87,7 +240,7 @@ func LoadConfig() (*Config, error) {
 	if timeoutConfigErr != nil {
 		return nil, fmt.Errorf("provided KPCEA_TIMEOUT must be a number")
 	}
-	interval, hasInterval := os.LookupEnv("KPCEA_INTERVAL")
+	interval, hasInterval := lookup("KPCEA_INTERVAL")
 	if !hasInterval {
 		interval = "5"
 	}
@@ -95,24 +248,229 @@ func LoadConfig() (*Config, error) {
 	if intervalConfigErr != nil {
 		return nil, fmt.Errorf("provided KPCEA_INTERVAL must be a number")
 	}
-	allowInsecure, hasInsecure := os.LookupEnv("KPCEA_INSECURE")
-	if !hasInsecure {
-		allowInsecure = "false"
+	failureGrace, hasFailureGrace := lookup("KPCEA_FAILURE_GRACE")
+	if !hasFailureGrace {
+		failureGrace = "30"
+	}
+	failureGraceSeconds, failureGraceConfigErr := strconv.Atoi(failureGrace)
+	if failureGraceConfigErr != nil {
+		return nil, fmt.Errorf("provided KPCEA_FAILURE_GRACE must be a number")
+	}
+	stableFor, stableForConfigErr := parseDuration(lookup.get("KPCEA_STABLE_FOR"))
+	if stableForConfigErr != nil {
+		return nil, fmt.Errorf("provided KPCEA_STABLE_FOR must be a number of seconds or a duration like 60s")
+	}
+	expectedAppCount := 0
+	if expectedApps := lookup.get("KPCEA_EXPECTED_APP_COUNT"); expectedApps != "" {
+		parsed, expectedAppsConfigErr := strconv.Atoi(expectedApps)
+		if expectedAppsConfigErr != nil || parsed < 1 {
+			return nil, fmt.Errorf("provided KPCEA_EXPECTED_APP_COUNT must be a positive number")
+		}
+		expectedAppCount = parsed
+	}
+	// KPCEA_INSECURE is deprecated, like before it only skips TLS verification and still connects with TLS
+	insecure := lookup.bool("KPCEA_INSECURE")
+	useGRPC := lookup.bool("KPCEA_USE_GRPC")
+	grpcWebRootPath := strings.Trim(lookup.get("KPCEA_GRPC_WEB_ROOT_PATH"), "/")
+	if useGRPC && grpcWebRootPath != "" {
+		return nil, fmt.Errorf("KPCEA_GRPC_WEB_ROOT_PATH can not be used together with KPCEA_USE_GRPC")
+	}
+	if grpcWebRootPath == "" && argoBasePath != "" {
+		// gRPC-web is served under the same path prefix as the rest of ArgoCD
+		if useGRPC {
+			return nil, fmt.Errorf("a path in ARGOCD_SERVER can not be used together with KPCEA_USE_GRPC")
+		}
+		grpcWebRootPath = argoBasePath
+	}
+	// The scheme of ARGOCD_SERVER takes precedence over KPCEA_PLAINTEXT
+	plainText := lookup.bool("KPCEA_PLAINTEXT")
+	if serverScheme != "" {
+		plainText = serverScheme == "http"
+	}
+	clientCertFile := lookup.get("KPCEA_CLIENT_CERT_FILE")
+	clientKeyFile := lookup.get("KPCEA_CLIENT_KEY_FILE")
+	if (clientCertFile == "") != (clientKeyFile == "") {
+		return nil, fmt.Errorf("KPCEA_CLIENT_CERT_FILE and KPCEA_CLIENT_KEY_FILE must be set together")
+	}
+	waitMode := PollWait
+	if lookup.get("KPCEA_WAIT_MODE") == "WATCH" {
+		waitMode = WatchWait
+	}
+	refresh := v1alpha1.RefreshType(lookup.get("KPCEA_REFRESH"))
+	if refresh != "" && refresh != v1alpha1.RefreshTypeNormal && refresh != v1alpha1.RefreshTypeHard {
+		return nil, fmt.Errorf("provided KPCEA_REFRESH must be normal or hard")
+	}
+	output := OutputFormat(lookup.get("KPCEA_OUTPUT"))
+	if output == "" {
+		output = TextOutput
+	} else if output != TextOutput && output != JsonOutput {
+		return nil, fmt.Errorf("provided KPCEA_OUTPUT must be text or json")
+	}
+	logFormat := LogFormat(lookup.get("KPCEA_LOG_FORMAT"))
+	if logFormat == "" {
+		logFormat = TextLog
+	} else if logFormat != TextLog && logFormat != JsonLog {
+		return nil, fmt.Errorf("provided KPCEA_LOG_FORMAT must be text or json")
+	}
+	logLevel := slog.LevelInfo
+	if level, hasLevel := lookup("KPCEA_LOG_LEVEL"); hasLevel && level != "" {
+		if levelErr := logLevel.UnmarshalText([]byte(level)); levelErr != nil {
+			return nil, fmt.Errorf("provided KPCEA_LOG_LEVEL must be debug, info, warn or error")
+		}
+	}
+	listenAddress, hasListenAddress := lookup("KPCEA_LISTEN_ADDRESS")
+	if !hasListenAddress || listenAddress == "" {
+		listenAddress = ":8080"
 	}
 
 	// Return configuration struct
 	return &Config{
 		ArgoServer:          argoServer,
+		ArgoBasePath:        argoBasePath,
 		ArgoApiToken:        argoApiToken,
+		ArgoApiTokenFile:    argoApiTokenFile,
 		ArgoAppName:         argoAppName,
+		ArgoAppNames:        argoAppNames,
+		ArgoAppNamespace:    lookup.get("ARGOCD_APP_NAMESPACE"),
+		ArgoAppProject:      lookup.get("ARGOCD_APP_PROJECT"),
+		AppSelector:         appSelector,
+		AppSetName:          appSetName,
+		ExpectedAppCount:    expectedAppCount,
 		ApiUsername:         apiUsername,
 		ApiPassword:         apiPassword,
 		AuthMode:            authMode,
 		TargetRevision:      targetRevision,
+		TargetRevisions:     targetRevisions,
 		SearchCommitMessage: searchCommitMessage,
+		CommitMessageRegex:  compiledCommitMessageRegex,
+		ExpectedImages:      expectedImages,
+		ChartVersion:        chartVersion,
+		ChartName:           chartName,
 		PollTimeout:         time.Duration(timeoutSeconds) * time.Second,
 		PollInterval:        time.Duration(intervalSeconds) * time.Second,
-		AllowInsecure:       allowInsecure == "true",
+		FailureGracePeriod:  time.Duration(failureGraceSeconds) * time.Second,
+		StableFor:           stableFor,
+		PlainText:           plainText,
+		TLSSkipVerify:       insecure || lookup.bool("KPCEA_TLS_SKIP_VERIFY"),
+		UseGRPC:             useGRPC,
+		GRPCWebRootPath:     grpcWebRootPath,
+		CAFile:              lookup.get("KPCEA_CA_FILE"),
+		ClientCertFile:      clientCertFile,
+		ClientKeyFile:       clientKeyFile,
+		ResolveRevision:     lookup.bool("KPCEA_RESOLVE_REVISION"),
+		WaitMode:            waitMode,
+		Refresh:             refresh,
+		TriggerSync:         lookup.bool("KPCEA_TRIGGER_SYNC"),
+		SyncPrune:           lookup.bool("KPCEA_SYNC_PRUNE"),
+		SyncForce:           lookup.bool("KPCEA_SYNC_FORCE"),
+		SyncDryRun:          lookup.bool("KPCEA_SYNC_DRY_RUN"),
+		Output:              output,
+		LogFormat:           logFormat,
+		LogLevel:            logLevel,
+		ListenAddress:       listenAddress,
 		VerifyMode:          verificationMode,
 	}, nil
 }
+
+// ArgoServerWithBasePath returns the host of ArgoCD, followed by its base path when ArgoCD is served under a path prefix.
+func (c *Config) ArgoServerWithBasePath() string {
+	if c.ArgoBasePath == "" {
+		return c.ArgoServer
+	}
+	return c.ArgoServer + "/" + c.ArgoBasePath
+}
+
+// parseArgoServer splits ARGOCD_SERVER into the host (with port) and the base path of ArgoCD.
+// It accepts a bare host like argocd.mydomain.xyz, or a full URL like https://tools.corp.example/argocd.
+// The scheme is only returned when it is part of the value.
+func parseArgoServer(value string) (string, string, string, error) {
+	if !strings.Contains(value, "://") {
+		host, basePath, _ := strings.Cut(value, "/")
+		return host, strings.Trim(basePath, "/"), "", nil
+	}
+	serverURL, err := url.Parse(value)
+	if err != nil || (serverURL.Scheme != "http" && serverURL.Scheme != "https") || serverURL.Host == "" {
+		return "", "", "", fmt.Errorf("provided ARGOCD_SERVER must be a host or a http(s) URL")
+	}
+	return serverURL.Host, strings.Trim(serverURL.Path, "/"), serverURL.Scheme, nil
+}
+
+// LookupFunc looks up a configuration value by the name of its environment variable, like os.LookupEnv.
+type LookupFunc func(key string) (string, bool)
+
+// get returns the value, or an empty string when it is not set.
+func (l LookupFunc) get(key string) string {
+	value, _ := l(key)
+	return value
+}
+
+// bool reads an optional flag. Only the value "true" enables it.
+func (l LookupFunc) bool(key string) bool {
+	return l.get(key) == "true"
+}
+
+// checkParams maps the query parameters of a check in serve mode to the environment variables they replace.
+var checkParams = map[string]string{
+	"app":          "ARGOCD_APP_NAME",
+	"namespace":    "ARGOCD_APP_NAMESPACE",
+	"project":      "ARGOCD_APP_PROJECT",
+	"mode":         "KPCEA_VERIFY_MODE",
+	"revision":     "KPCEA_TARGET_REVISION",
+	"revisions":    "KPCEA_TARGET_REVISIONS",
+	"message":      "KPCEA_SEARCH_COMMIT_MSG",
+	"regex":        "KPCEA_COMMIT_MSG_REGEX",
+	"images":       "KPCEA_EXPECTED_IMAGES",
+	"chartVersion": "KPCEA_CHART_VERSION",
+	"chart":        "KPCEA_CHART_NAME",
+	"timeout":      "KPCEA_TIMEOUT",
+}
+
+// checkParamsLookup looks up a value in the query parameters first, and falls back to the environment variables.
+func checkParamsLookup(params url.Values) LookupFunc {
+	return func(key string) (string, bool) {
+		for param, envKey := range checkParams {
+			if envKey == key && params.Has(param) {
+				return params.Get(param), true
+			}
+		}
+		return os.LookupEnv(key)
+	}
+}
+
+// PluginCheckParams converts the configuration of a metric in an Argo Rollouts AnalysisTemplate to the query parameters of a check.
+// The settings have the same names as the query parameters, and can be strings or numbers.
+func PluginCheckParams(pluginConfig []byte) (url.Values, error) {
+	decoder := json.NewDecoder(bytes.NewReader(pluginConfig))
+	decoder.UseNumber()
+	var settings map[string]any
+	if err := decoder.Decode(&settings); err != nil {
+		return nil, fmt.Errorf("provided plugin configuration is invalid: %v", err)
+	}
+	params := url.Values{}
+	for key, value := range settings {
+		if _, ok := checkParams[key]; !ok {
+			return nil, fmt.Errorf("provided plugin setting '%s' is not supported", key)
+		}
+		switch typed := value.(type) {
+		case string:
+			params.Set(key, typed)
+		case json.Number:
+			params.Set(key, typed.String())
+		default:
+			return nil, fmt.Errorf("provided plugin setting '%s' must be a string or a number", key)
+		}
+	}
+	return params, nil
+}
+
+// parseDuration reads a duration as a number of seconds (e.g. "60") or as a Go duration (e.g. "1m30s").
+// An empty value is a zero duration.
+func parseDuration(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	return time.ParseDuration(value)
+}
@@ -1,8 +1,12 @@
 package internal
 
 import (
+	"github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
 	"github.com/stretchr/testify/assert"
+	"log/slog"
+	"net/url"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 )
@@ -44,17 +48,37 @@ func TestLoadConfig_MinimalValidEnvVars_TokenMode(t *testing.T) {
 
 	assert.NoError(t, err)
 	assert.Equal(t, "argocd-server", config.ArgoServer)
+	assert.Equal(t, "", config.ArgoBasePath)
 	assert.Equal(t, "argo-app-name", config.ArgoAppName)
+	assert.Equal(t, []string{"argo-app-name"}, config.ArgoAppNames)
+	assert.Equal(t, "", config.ArgoAppNamespace)
+	assert.Equal(t, "", config.ArgoAppProject)
+	assert.Equal(t, "", config.AppSelector)
+	assert.Equal(t, "", config.AppSetName)
+	assert.Equal(t, 0, config.ExpectedAppCount)
 	assert.Equal(t, Exact, config.VerifyMode)
 	assert.Equal(t, "target-revision", config.TargetRevision)
 	assert.Equal(t, "", config.SearchCommitMessage)
 	assert.Equal(t, TokenMode, config.AuthMode)
 	assert.Equal(t, "api-token", config.ArgoApiToken)
+	assert.Equal(t, "", config.ArgoApiTokenFile)
 	assert.Equal(t, "", config.ApiUsername)
 	assert.Equal(t, "", config.ApiPassword)
 	assert.Equal(t, 30*time.Second, config.PollTimeout)
 	assert.Equal(t, 5*time.Second, config.PollInterval)
-	assert.Equal(t, false, config.AllowInsecure)
+	assert.Equal(t, false, config.PlainText)
+	assert.Equal(t, false, config.TLSSkipVerify)
+	assert.Equal(t, false, config.ResolveRevision)
+	assert.Equal(t, PollWait, config.WaitMode)
+	assert.Equal(t, false, config.TriggerSync)
+	assert.Equal(t, v1alpha1.RefreshType(""), config.Refresh)
+	assert.Equal(t, 30*time.Second, config.FailureGracePeriod)
+	assert.Equal(t, time.Duration(0), config.StableFor)
+	assert.Equal(t, TextOutput, config.Output)
+	assert.Equal(t, false, config.UseGRPC)
+	assert.Equal(t, "", config.GRPCWebRootPath)
+	assert.Equal(t, TextLog, config.LogFormat)
+	assert.Equal(t, slog.LevelInfo, config.LogLevel)
 }
 
 func TestLoadConfig_MinimalValidEnvVars_LoginMode(t *testing.T) {
@@ -84,7 +108,8 @@ func TestLoadConfig_MinimalValidEnvVars_LoginMode(t *testing.T) {
 	assert.Equal(t, "api-password", config.ApiPassword)
 	assert.Equal(t, 20*time.Second, config.PollTimeout)
 	assert.Equal(t, 3*time.Second, config.PollInterval)
-	assert.Equal(t, true, config.AllowInsecure)
+	assert.Equal(t, false, config.PlainText)
+	assert.Equal(t, true, config.TLSSkipVerify)
 }
 
 func TestLoadConfig_AllValidEnvVars_TokenMode(t *testing.T) {
@@ -113,7 +138,8 @@ func TestLoadConfig_AllValidEnvVars_TokenMode(t *testing.T) {
 	assert.Equal(t, "", config.ApiPassword)
 	assert.Equal(t, 20*time.Second, config.PollTimeout)
 	assert.Equal(t, 3*time.Second, config.PollInterval)
-	assert.Equal(t, true, config.AllowInsecure)
+	assert.Equal(t, false, config.PlainText)
+	assert.Equal(t, true, config.TLSSkipVerify)
 }
 
 func TestLoadConfig_AllValidEnvVars_LoginMode(t *testing.T) {
@@ -140,7 +166,8 @@ func TestLoadConfig_AllValidEnvVars_LoginMode(t *testing.T) {
 	assert.Equal(t, "api-password", config.ApiPassword)
 	assert.Equal(t, 30*time.Second, config.PollTimeout)
 	assert.Equal(t, 5*time.Second, config.PollInterval)
-	assert.Equal(t, false, config.AllowInsecure)
+	assert.Equal(t, false, config.PlainText)
+	assert.Equal(t, false, config.TLSSkipVerify)
 }
 
 func TestLoadConfig_MissingArgoServerProperty(t *testing.T) {
@@ -201,6 +228,89 @@ func TestLoadConfig_EmptyArgoAppNameProperty(t *testing.T) {
 	assert.Equal(t, "ARGOCD_SERVER and ARGOCD_APP_NAME must be set", err.Error())
 }
 
+func TestLoadConfig_CommaSeparatedArgoAppNames(t *testing.T) {
+	cleanup := setEnvVars(t, map[string]string{
+		"ARGOCD_SERVER":         "argocd-server",
+		"ARGOCD_APP_NAME":       "api, worker,,cron ",
+		"KPCEA_TARGET_REVISION": "target-revision",
+		"ARGOCD_API_TOKEN":      "api-token",
+	})
+	defer cleanup()
+
+	config, err := LoadConfig()
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"api", "worker", "cron"}, config.ArgoAppNames)
+}
+
+func TestLoadConfig_ArgoAppNamespaceAndProject(t *testing.T) {
+	cleanup := setEnvVars(t, map[string]string{
+		"ARGOCD_SERVER":         "argocd-server",
+		"ARGOCD_APP_NAME":       "argo-app-name",
+		"ARGOCD_APP_NAMESPACE":  "team-payments",
+		"ARGOCD_APP_PROJECT":    "payments",
+		"KPCEA_TARGET_REVISION": "target-revision",
+		"ARGOCD_API_TOKEN":      "api-token",
+	})
+	defer cleanup()
+
+	config, err := LoadConfig()
+
+	assert.NoError(t, err)
+	assert.Equal(t, "team-payments", config.ArgoAppNamespace)
+	assert.Equal(t, "payments", config.ArgoAppProject)
+}
+
+func TestLoadConfig_AppSelectorInsteadOfArgoAppName(t *testing.T) {
+	cleanup := setEnvVars(t, map[string]string{
+		"ARGOCD_SERVER":         "argocd-server",
+		"KPCEA_APP_SELECTOR":    "team=payments,env=uat",
+		"KPCEA_TARGET_REVISION": "target-revision",
+		"ARGOCD_API_TOKEN":      "api-token",
+	})
+	defer cleanup()
+
+	config, err := LoadConfig()
+
+	assert.NoError(t, err)
+	assert.Equal(t, "team=payments,env=uat", config.AppSelector)
+	assert.Empty(t, config.ArgoAppNames)
+}
+
+func TestLoadConfig_AppSetNameInsteadOfArgoAppName(t *testing.T) {
+	cleanup := setEnvVars(t, map[string]string{
+		"ARGOCD_SERVER":            "argocd-server",
+		"ARGOCD_APPSET_NAME":       "api",
+		"KPCEA_EXPECTED_APP_COUNT": "3",
+		"KPCEA_TARGET_REVISION":    "target-revision",
+		"ARGOCD_API_TOKEN":         "api-token",
+	})
+	defer cleanup()
+
+	config, err := LoadConfig()
+
+	assert.NoError(t, err)
+	assert.Equal(t, "api", config.AppSetName)
+	assert.Equal(t, 3, config.ExpectedAppCount)
+	assert.Empty(t, config.ArgoAppNames)
+}
+
+func TestLoadConfig_InvalidExpectedAppCountValue(t *testing.T) {
+	cleanup := setEnvVars(t, map[string]string{
+		"ARGOCD_SERVER":            "argocd-server",
+		"ARGOCD_APPSET_NAME":       "api",
+		"KPCEA_EXPECTED_APP_COUNT": "0",
+		"KPCEA_TARGET_REVISION":    "target-revision",
+		"ARGOCD_API_TOKEN":         "api-token",
+	})
+	defer cleanup()
+
+	_, err := LoadConfig()
+
+	assert.Error(t, err)
+	assert.Equal(t, "provided KPCEA_EXPECTED_APP_COUNT must be a positive number", err.Error())
+}
+
 func TestLoadConfig_MissingTargetRevisionProperty(t *testing.T) {
 	cleanup := setEnvVars(t, map[string]string{
 		"ARGOCD_SERVER":    "argocd-server",
@@ -212,7 +322,7 @@ func TestLoadConfig_MissingTargetRevisionProperty(t *testing.T) {
 	_, err := LoadConfig()
 
 	assert.Error(t, err)
-	assert.Equal(t, "KPCEA_TARGET_REVISION must be set for verification mode EXACT", err.Error())
+	assert.Equal(t, "KPCEA_TARGET_REVISION or KPCEA_TARGET_REVISIONS must be set for verification mode EXACT", err.Error())
 }
 
 func TestLoadConfig_EmptyTargetRevisionProperty(t *testing.T) {
@@ -227,7 +337,7 @@ func TestLoadConfig_EmptyTargetRevisionProperty(t *testing.T) {
 	_, err := LoadConfig()
 
 	assert.Error(t, err)
-	assert.Equal(t, "KPCEA_TARGET_REVISION must be set for verification mode EXACT", err.Error())
+	assert.Equal(t, "KPCEA_TARGET_REVISION or KPCEA_TARGET_REVISIONS must be set for verification mode EXACT", err.Error())
 }
 
 func TestLoadConfig_MissingCredentialsOrTokenProperties(t *testing.T) {
@@ -297,6 +407,24 @@ func TestLoadConfig_InvalidIntervalValue(t *testing.T) {
 	assert.Equal(t, "provided KPCEA_INTERVAL must be a number", err.Error())
 }
 
+func TestLoadConfig_DeprecatedInsecureOnlySkipsTLSVerification(t *testing.T) {
+	cleanup := setEnvVars(t, map[string]string{
+		"ARGOCD_SERVER":         "argocd-server:443",
+		"ARGOCD_APP_NAME":       "argo-app-name",
+		"KPCEA_TARGET_REVISION": "target-revision",
+		"ARGOCD_API_TOKEN":      "api-token",
+		"KPCEA_INSECURE":        "true",
+	})
+	defer cleanup()
+
+	config, err := LoadConfig()
+
+	// Existing users with a self-signed certificate must keep connecting with TLS
+	assert.NoError(t, err)
+	assert.Equal(t, false, config.PlainText)
+	assert.Equal(t, true, config.TLSSkipVerify)
+}
+
 func TestLoadConfig_InvalidInsecureValueDoesNotMakeItSecure(t *testing.T) {
 	cleanup := setEnvVars(t, map[string]string{
 		"ARGOCD_SERVER":         "argocd-server",
@@ -310,7 +438,8 @@ func TestLoadConfig_InvalidInsecureValueDoesNotMakeItSecure(t *testing.T) {
 	config, err := LoadConfig()
 
 	assert.NoError(t, err)
-	assert.Equal(t, false, config.AllowInsecure)
+	assert.Equal(t, false, config.PlainText)
+	assert.Equal(t, false, config.TLSSkipVerify)
 }
 
 func TestLoadConfig_ProvidedSearchCommitMsgInsteadOfTargetRevision(t *testing.T) {
@@ -325,7 +454,7 @@ func TestLoadConfig_ProvidedSearchCommitMsgInsteadOfTargetRevision(t *testing.T)
 	_, err := LoadConfig()
 
 	assert.Error(t, err)
-	assert.Equal(t, "KPCEA_TARGET_REVISION must be set for verification mode EXACT", err.Error())
+	assert.Equal(t, "KPCEA_TARGET_REVISION or KPCEA_TARGET_REVISIONS must be set for verification mode EXACT", err.Error())
 }
 
 func TestLoadConfig_InvalidVerifyModeValueDefaultsToExact(t *testing.T) {
@@ -352,7 +481,8 @@ func TestLoadConfig_InvalidVerifyModeValueDefaultsToExact(t *testing.T) {
 	assert.Equal(t, "", config.ApiPassword)
 	assert.Equal(t, 30*time.Second, config.PollTimeout)
 	assert.Equal(t, 5*time.Second, config.PollInterval)
-	assert.Equal(t, false, config.AllowInsecure)
+	assert.Equal(t, false, config.PlainText)
+	assert.Equal(t, false, config.TLSSkipVerify)
 }
 
 func TestLoadConfig_VerifyModeSearchSelectedButNoParameterProvided(t *testing.T) {
@@ -426,5 +556,837 @@ func TestLoadConfig_MinimalValidEnvVars_SearchCommitMsgMode(t *testing.T) {
 	assert.Equal(t, "", config.ApiPassword)
 	assert.Equal(t, 30*time.Second, config.PollTimeout)
 	assert.Equal(t, 5*time.Second, config.PollInterval)
-	assert.Equal(t, false, config.AllowInsecure)
+	assert.Equal(t, false, config.PlainText)
+	assert.Equal(t, false, config.TLSSkipVerify)
+}
+
+func TestLoadConfig_MinimalValidEnvVars_RegexCommitMsgMode(t *testing.T) {
+	cleanup := setEnvVars(t, map[string]string{
+		"ARGOCD_SERVER":          "argocd-server",
+		"ARGOCD_APP_NAME":        "argo-app-name",
+		"KPCEA_VERIFY_MODE":      "REGEX_COMMIT_MSG",
+		"KPCEA_COMMIT_MSG_REGEX": `^Promote freight (?P<freight>\w+) to stage uat \(`,
+		"ARGOCD_API_TOKEN":       "api-token",
+	})
+	defer cleanup()
+
+	config, err := LoadConfig()
+
+	assert.NoError(t, err)
+	assert.Equal(t, RegexCommitMessage, config.VerifyMode)
+	assert.Equal(t, "", config.TargetRevision)
+	assert.Equal(t, "", config.SearchCommitMessage)
+	assert.NotNil(t, config.CommitMessageRegex)
+	assert.Equal(t, `^Promote freight (?P<freight>\w+) to stage uat \(`, config.CommitMessageRegex.String())
+}
+
+func TestLoadConfig_VerifyModeRegexSelectedButNoParameterProvided(t *testing.T) {
+	cleanup := setEnvVars(t, map[string]string{
+		"ARGOCD_SERVER":           "argocd-server",
+		"ARGOCD_APP_NAME":         "argo-app-name",
+		"KPCEA_VERIFY_MODE":       "REGEX_COMMIT_MSG",
+		"KPCEA_SEARCH_COMMIT_MSG": "search-param",
+		"ARGOCD_API_TOKEN":        "api-token",
+	})
+	defer cleanup()
+
+	_, err := LoadConfig()
+
+	assert.Error(t, err)
+	assert.Equal(t, "KPCEA_COMMIT_MSG_REGEX must be set for verification mode REGEX_COMMIT_MSG", err.Error())
+}
+
+func TestLoadConfig_VerifyModeRegexSelectedWithInvalidPattern(t *testing.T) {
+	cleanup := setEnvVars(t, map[string]string{
+		"ARGOCD_SERVER":          "argocd-server",
+		"ARGOCD_APP_NAME":        "argo-app-name",
+		"KPCEA_VERIFY_MODE":      "REGEX_COMMIT_MSG",
+		"KPCEA_COMMIT_MSG_REGEX": "stage (uat",
+		"ARGOCD_API_TOKEN":       "api-token",
+	})
+	defer cleanup()
+
+	_, err := LoadConfig()
+
+	assert.Error(t, err)
+	assert.Equal(t, "provided KPCEA_COMMIT_MSG_REGEX is not a valid regular expression: error parsing regexp: missing closing ): `stage (uat`", err.Error())
+}
+
+func TestLoadConfig_RegexIgnoredOutsideRegexMode(t *testing.T) {
+	cleanup := setEnvVars(t, map[string]string{
+		"ARGOCD_SERVER":          "argocd-server",
+		"ARGOCD_APP_NAME":        "argo-app-name",
+		"KPCEA_TARGET_REVISION":  "target-revision",
+		"KPCEA_COMMIT_MSG_REGEX": "stage (uat",
+		"ARGOCD_API_TOKEN":       "api-token",
+	})
+	defer cleanup()
+
+	config, err := LoadConfig()
+
+	assert.NoError(t, err)
+	assert.Equal(t, Exact, config.VerifyMode)
+	assert.Nil(t, config.CommitMessageRegex)
+}
+
+func TestLoadConfig_MinimalValidEnvVars_ImagesMode(t *testing.T) {
+	cleanup := setEnvVars(t, map[string]string{
+		"ARGOCD_SERVER":         "argocd-server",
+		"ARGOCD_APP_NAME":       "argo-app-name",
+		"KPCEA_VERIFY_MODE":     "IMAGES",
+		"KPCEA_EXPECTED_IMAGES": "repo/api:1.4.2,repo/worker:1.4.2",
+		"ARGOCD_API_TOKEN":      "api-token",
+	})
+	defer cleanup()
+
+	config, err := LoadConfig()
+
+	assert.NoError(t, err)
+	assert.Equal(t, Images, config.VerifyMode)
+	assert.Equal(t, "", config.TargetRevision)
+	assert.Equal(t, []ExpectedImage{
+		{Repository: "repo/api", Tag: "1.4.2"},
+		{Repository: "repo/worker", Tag: "1.4.2"},
+	}, config.ExpectedImages)
+}
+
+func TestLoadConfig_VerifyModeImagesSelectedButNoParameterProvided(t *testing.T) {
+	cleanup := setEnvVars(t, map[string]string{
+		"ARGOCD_SERVER":         "argocd-server",
+		"ARGOCD_APP_NAME":       "argo-app-name",
+		"KPCEA_VERIFY_MODE":     "IMAGES",
+		"KPCEA_TARGET_REVISION": "target-revision",
+		"ARGOCD_API_TOKEN":      "api-token",
+	})
+	defer cleanup()
+
+	_, err := LoadConfig()
+
+	assert.Error(t, err)
+	assert.Equal(t, "KPCEA_EXPECTED_IMAGES must be set for verification mode IMAGES", err.Error())
+}
+
+func TestLoadConfig_VerifyModeImagesSelectedWithInvalidImages(t *testing.T) {
+	cleanup := setEnvVars(t, map[string]string{
+		"ARGOCD_SERVER":         "argocd-server",
+		"ARGOCD_APP_NAME":       "argo-app-name",
+		"KPCEA_VERIFY_MODE":     "IMAGES",
+		"KPCEA_EXPECTED_IMAGES": "repo/api",
+		"ARGOCD_API_TOKEN":      "api-token",
+	})
+	defer cleanup()
+
+	_, err := LoadConfig()
+
+	assert.Error(t, err)
+	assert.Equal(t, "provided KPCEA_EXPECTED_IMAGES is invalid: image reference 'repo/api' must have a tag or digest", err.Error())
+}
+
+func TestLoadConfig_MinimalValidEnvVars_MultiSourceExactMode(t *testing.T) {
+	cleanup := setEnvVars(t, map[string]string{
+		"ARGOCD_SERVER":          "argocd-server",
+		"ARGOCD_APP_NAME":        "argo-app-name",
+		"KPCEA_TARGET_REVISIONS": "https://github.com/org/charts=v2.3.0;abc123",
+		"ARGOCD_API_TOKEN":       "api-token",
+	})
+	defer cleanup()
+
+	config, err := LoadConfig()
+
+	assert.NoError(t, err)
+	assert.Equal(t, Exact, config.VerifyMode)
+	assert.Equal(t, "", config.TargetRevision)
+	assert.Equal(t, []SourceRevision{
+		{RepoURL: "https://github.com/org/charts", Index: 0, Revision: "v2.3.0"},
+		{Index: 1, Revision: "abc123"},
+	}, config.TargetRevisions)
+}
+
+func TestLoadConfig_InvalidTargetRevisions(t *testing.T) {
+	cleanup := setEnvVars(t, map[string]string{
+		"ARGOCD_SERVER":          "argocd-server",
+		"ARGOCD_APP_NAME":        "argo-app-name",
+		"KPCEA_TARGET_REVISIONS": "https://github.com/org/charts=",
+		"ARGOCD_API_TOKEN":       "api-token",
+	})
+	defer cleanup()
+
+	_, err := LoadConfig()
+
+	assert.Error(t, err)
+	assert.Equal(t, "provided KPCEA_TARGET_REVISIONS is invalid: entry 'https://github.com/org/charts=' has no revision", err.Error())
+}
+
+func TestLoadConfig_ResolveRevisionEnabled(t *testing.T) {
+	cleanup := setEnvVars(t, map[string]string{
+		"ARGOCD_SERVER":          "argocd-server",
+		"ARGOCD_APP_NAME":        "argo-app-name",
+		"KPCEA_TARGET_REVISION":  "v1.8.0",
+		"ARGOCD_API_TOKEN":       "api-token",
+		"KPCEA_RESOLVE_REVISION": "true",
+	})
+	defer cleanup()
+
+	config, err := LoadConfig()
+
+	assert.NoError(t, err)
+	assert.Equal(t, "v1.8.0", config.TargetRevision)
+	assert.Equal(t, true, config.ResolveRevision)
+}
+
+func TestLoadConfig_MinimalValidEnvVars_HelmChartVersionMode(t *testing.T) {
+	cleanup := setEnvVars(t, map[string]string{
+		"ARGOCD_SERVER":       "argocd-server",
+		"ARGOCD_APP_NAME":     "argo-app-name",
+		"KPCEA_VERIFY_MODE":   "HELM_CHART_VERSION",
+		"KPCEA_CHART_VERSION": ">=1.4.0 <2.0.0",
+		"KPCEA_CHART_NAME":    "api",
+		"ARGOCD_API_TOKEN":    "api-token",
+	})
+	defer cleanup()
+
+	config, err := LoadConfig()
+
+	assert.NoError(t, err)
+	assert.Equal(t, HelmChartVersion, config.VerifyMode)
+	assert.Equal(t, ">=1.4.0 <2.0.0", config.ChartVersion.String())
+	assert.Equal(t, "api", config.ChartName)
+}
+
+func TestLoadConfig_VerifyModeHelmChartVersionSelectedButNoParameterProvided(t *testing.T) {
+	cleanup := setEnvVars(t, map[string]string{
+		"ARGOCD_SERVER":     "argocd-server",
+		"ARGOCD_APP_NAME":   "argo-app-name",
+		"KPCEA_VERIFY_MODE": "HELM_CHART_VERSION",
+		"ARGOCD_API_TOKEN":  "api-token",
+	})
+	defer cleanup()
+
+	_, err := LoadConfig()
+
+	assert.Error(t, err)
+	assert.Equal(t, "KPCEA_CHART_VERSION must be set for verification mode HELM_CHART_VERSION", err.Error())
+}
+
+func TestLoadConfig_VerifyModeHelmChartVersionSelectedWithInvalidConstraint(t *testing.T) {
+	cleanup := setEnvVars(t, map[string]string{
+		"ARGOCD_SERVER":       "argocd-server",
+		"ARGOCD_APP_NAME":     "argo-app-name",
+		"KPCEA_VERIFY_MODE":   "HELM_CHART_VERSION",
+		"KPCEA_CHART_VERSION": "latest",
+		"ARGOCD_API_TOKEN":    "api-token",
+	})
+	defer cleanup()
+
+	_, err := LoadConfig()
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "provided KPCEA_CHART_VERSION is not a valid semver constraint: ")
+}
+
+func TestLoadConfig_WatchWaitMode(t *testing.T) {
+	cleanup := setEnvVars(t, map[string]string{
+		"ARGOCD_SERVER":         "argocd-server",
+		"ARGOCD_APP_NAME":       "argo-app-name",
+		"KPCEA_TARGET_REVISION": "target-revision",
+		"ARGOCD_API_TOKEN":      "api-token",
+		"KPCEA_WAIT_MODE":       "WATCH",
+	})
+	defer cleanup()
+
+	config, err := LoadConfig()
+
+	assert.NoError(t, err)
+	assert.Equal(t, WatchWait, config.WaitMode)
+}
+
+func TestLoadConfig_InvalidWaitModeDefaultsToPoll(t *testing.T) {
+	cleanup := setEnvVars(t, map[string]string{
+		"ARGOCD_SERVER":         "argocd-server",
+		"ARGOCD_APP_NAME":       "argo-app-name",
+		"KPCEA_TARGET_REVISION": "target-revision",
+		"ARGOCD_API_TOKEN":      "api-token",
+		"KPCEA_WAIT_MODE":       "stream",
+	})
+	defer cleanup()
+
+	config, err := LoadConfig()
+
+	assert.NoError(t, err)
+	assert.Equal(t, PollWait, config.WaitMode)
+}
+
+func TestLoadConfig_TriggerSyncWithOptions(t *testing.T) {
+	cleanup := setEnvVars(t, map[string]string{
+		"ARGOCD_SERVER":         "argocd-server",
+		"ARGOCD_APP_NAME":       "argo-app-name",
+		"KPCEA_TARGET_REVISION": "target-revision",
+		"ARGOCD_API_TOKEN":      "api-token",
+		"KPCEA_TRIGGER_SYNC":    "true",
+		"KPCEA_SYNC_PRUNE":      "true",
+		"KPCEA_SYNC_FORCE":      "yes",
+		"KPCEA_SYNC_DRY_RUN":    "true",
+	})
+	defer cleanup()
+
+	config, err := LoadConfig()
+
+	assert.NoError(t, err)
+	assert.Equal(t, true, config.TriggerSync)
+	assert.Equal(t, true, config.SyncPrune)
+	assert.Equal(t, false, config.SyncForce)
+	assert.Equal(t, true, config.SyncDryRun)
+}
+
+func TestLoadConfig_HardRefresh(t *testing.T) {
+	cleanup := setEnvVars(t, map[string]string{
+		"ARGOCD_SERVER":         "argocd-server",
+		"ARGOCD_APP_NAME":       "argo-app-name",
+		"KPCEA_TARGET_REVISION": "target-revision",
+		"ARGOCD_API_TOKEN":      "api-token",
+		"KPCEA_REFRESH":         "hard",
+	})
+	defer cleanup()
+
+	config, err := LoadConfig()
+
+	assert.NoError(t, err)
+	assert.Equal(t, v1alpha1.RefreshTypeHard, config.Refresh)
+}
+
+func TestLoadConfig_InvalidRefreshValue(t *testing.T) {
+	cleanup := setEnvVars(t, map[string]string{
+		"ARGOCD_SERVER":         "argocd-server",
+		"ARGOCD_APP_NAME":       "argo-app-name",
+		"KPCEA_TARGET_REVISION": "target-revision",
+		"ARGOCD_API_TOKEN":      "api-token",
+		"KPCEA_REFRESH":         "true",
+	})
+	defer cleanup()
+
+	_, err := LoadConfig()
+
+	assert.Error(t, err)
+	assert.Equal(t, "provided KPCEA_REFRESH must be normal or hard", err.Error())
+}
+
+func TestLoadConfig_FailureGracePeriod(t *testing.T) {
+	cleanup := setEnvVars(t, map[string]string{
+		"ARGOCD_SERVER":         "argocd-server",
+		"ARGOCD_APP_NAME":       "argo-app-name",
+		"KPCEA_TARGET_REVISION": "target-revision",
+		"ARGOCD_API_TOKEN":      "api-token",
+		"KPCEA_FAILURE_GRACE":   "0",
+	})
+	defer cleanup()
+
+	config, err := LoadConfig()
+
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(0), config.FailureGracePeriod)
+}
+
+func TestLoadConfig_InvalidFailureGraceValue(t *testing.T) {
+	cleanup := setEnvVars(t, map[string]string{
+		"ARGOCD_SERVER":         "argocd-server",
+		"ARGOCD_APP_NAME":       "argo-app-name",
+		"KPCEA_TARGET_REVISION": "target-revision",
+		"ARGOCD_API_TOKEN":      "api-token",
+		"KPCEA_FAILURE_GRACE":   "soon",
+	})
+	defer cleanup()
+
+	_, err := LoadConfig()
+
+	assert.Error(t, err)
+	assert.Equal(t, "provided KPCEA_FAILURE_GRACE must be a number", err.Error())
+}
+
+func TestLoadConfig_StableForDuration(t *testing.T) {
+	for value, expected := range map[string]time.Duration{"60s": 60 * time.Second, "1m30s": 90 * time.Second, "45": 45 * time.Second} {
+		cleanup := setEnvVars(t, map[string]string{
+			"ARGOCD_SERVER":         "argocd-server",
+			"ARGOCD_APP_NAME":       "argo-app-name",
+			"KPCEA_TARGET_REVISION": "target-revision",
+			"ARGOCD_API_TOKEN":      "api-token",
+			"KPCEA_STABLE_FOR":      value,
+		})
+
+		config, err := LoadConfig()
+		cleanup()
+
+		assert.NoError(t, err)
+		assert.Equal(t, expected, config.StableFor)
+	}
+}
+
+func TestLoadConfig_InvalidStableForValue(t *testing.T) {
+	cleanup := setEnvVars(t, map[string]string{
+		"ARGOCD_SERVER":         "argocd-server",
+		"ARGOCD_APP_NAME":       "argo-app-name",
+		"KPCEA_TARGET_REVISION": "target-revision",
+		"ARGOCD_API_TOKEN":      "api-token",
+		"KPCEA_STABLE_FOR":      "a minute",
+	})
+	defer cleanup()
+
+	_, err := LoadConfig()
+
+	assert.Error(t, err)
+	assert.Equal(t, "provided KPCEA_STABLE_FOR must be a number of seconds or a duration like 60s", err.Error())
+}
+
+func TestLoadConfig_JsonOutput(t *testing.T) {
+	cleanup := setEnvVars(t, map[string]string{
+		"ARGOCD_SERVER":         "argocd-server",
+		"ARGOCD_APP_NAME":       "argo-app-name",
+		"KPCEA_TARGET_REVISION": "target-revision",
+		"ARGOCD_API_TOKEN":      "api-token",
+		"KPCEA_OUTPUT":          "json",
+	})
+	defer cleanup()
+
+	config, err := LoadConfig()
+
+	assert.NoError(t, err)
+	assert.Equal(t, JsonOutput, config.Output)
+}
+
+func TestLoadConfig_InvalidOutputValue(t *testing.T) {
+	cleanup := setEnvVars(t, map[string]string{
+		"ARGOCD_SERVER":         "argocd-server",
+		"ARGOCD_APP_NAME":       "argo-app-name",
+		"KPCEA_TARGET_REVISION": "target-revision",
+		"ARGOCD_API_TOKEN":      "api-token",
+		"KPCEA_OUTPUT":          "yaml",
+	})
+	defer cleanup()
+
+	_, err := LoadConfig()
+
+	assert.Error(t, err)
+	assert.Equal(t, "provided KPCEA_OUTPUT must be text or json", err.Error())
+}
+
+func TestLoadConfig_JsonLogFormatAndDebugLevel(t *testing.T) {
+	cleanup := setEnvVars(t, map[string]string{
+		"ARGOCD_SERVER":         "argocd-server",
+		"ARGOCD_APP_NAME":       "argo-app-name",
+		"KPCEA_TARGET_REVISION": "target-revision",
+		"ARGOCD_API_TOKEN":      "api-token",
+		"KPCEA_LOG_FORMAT":      "json",
+		"KPCEA_LOG_LEVEL":       "debug",
+	})
+	defer cleanup()
+
+	config, err := LoadConfig()
+
+	assert.NoError(t, err)
+	assert.Equal(t, JsonLog, config.LogFormat)
+	assert.Equal(t, slog.LevelDebug, config.LogLevel)
+}
+
+func TestLoadConfig_InvalidLogFormatValue(t *testing.T) {
+	cleanup := setEnvVars(t, map[string]string{
+		"ARGOCD_SERVER":         "argocd-server",
+		"ARGOCD_APP_NAME":       "argo-app-name",
+		"KPCEA_TARGET_REVISION": "target-revision",
+		"ARGOCD_API_TOKEN":      "api-token",
+		"KPCEA_LOG_FORMAT":      "logfmt",
+	})
+	defer cleanup()
+
+	_, err := LoadConfig()
+
+	assert.Error(t, err)
+	assert.Equal(t, "provided KPCEA_LOG_FORMAT must be text or json", err.Error())
+}
+
+func TestLoadConfig_InvalidLogLevelValue(t *testing.T) {
+	cleanup := setEnvVars(t, map[string]string{
+		"ARGOCD_SERVER":         "argocd-server",
+		"ARGOCD_APP_NAME":       "argo-app-name",
+		"KPCEA_TARGET_REVISION": "target-revision",
+		"ARGOCD_API_TOKEN":      "api-token",
+		"KPCEA_LOG_LEVEL":       "verbose",
+	})
+	defer cleanup()
+
+	_, err := LoadConfig()
+
+	assert.Error(t, err)
+	assert.Equal(t, "provided KPCEA_LOG_LEVEL must be debug, info, warn or error", err.Error())
+}
+
+func TestLoadConfig_ApiTokenFile(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	_ = os.WriteFile(tokenFile, []byte("file-token\n"), 0600)
+	cleanup := setEnvVars(t, map[string]string{
+		"ARGOCD_SERVER":         "argocd-server",
+		"ARGOCD_APP_NAME":       "argo-app-name",
+		"KPCEA_TARGET_REVISION": "target-revision",
+		"ARGOCD_API_TOKEN_FILE": tokenFile,
+	})
+	defer cleanup()
+
+	config, err := LoadConfig()
+
+	assert.NoError(t, err)
+	assert.Equal(t, TokenMode, config.AuthMode)
+	assert.Equal(t, "file-token", config.ArgoApiToken)
+	assert.Equal(t, tokenFile, config.ArgoApiTokenFile)
+}
+
+func TestLoadConfig_ApiTokenTakesPrecedenceOverTokenFile(t *testing.T) {
+	cleanup := setEnvVars(t, map[string]string{
+		"ARGOCD_SERVER":         "argocd-server",
+		"ARGOCD_APP_NAME":       "argo-app-name",
+		"KPCEA_TARGET_REVISION": "target-revision",
+		"ARGOCD_API_TOKEN":      "api-token",
+		"ARGOCD_API_TOKEN_FILE": "/does/not/exist",
+	})
+	defer cleanup()
+
+	config, err := LoadConfig()
+
+	assert.NoError(t, err)
+	assert.Equal(t, "api-token", config.ArgoApiToken)
+	assert.Equal(t, "", config.ArgoApiTokenFile)
+}
+
+func TestLoadConfig_UnreadableApiTokenFile(t *testing.T) {
+	cleanup := setEnvVars(t, map[string]string{
+		"ARGOCD_SERVER":         "argocd-server",
+		"ARGOCD_APP_NAME":       "argo-app-name",
+		"KPCEA_TARGET_REVISION": "target-revision",
+		"ARGOCD_API_TOKEN_FILE": "/does/not/exist",
+	})
+	defer cleanup()
+
+	_, err := LoadConfig()
+
+	assert.Error(t, err)
+	assert.Equal(t, "provided ARGOCD_API_TOKEN_FILE can not be read: open /does/not/exist: no such file or directory", err.Error())
+}
+
+func TestLoadConfig_TLSFiles(t *testing.T) {
+	cleanup := setEnvVars(t, map[string]string{
+		"ARGOCD_SERVER":          "argocd-server",
+		"ARGOCD_APP_NAME":        "argo-app-name",
+		"KPCEA_TARGET_REVISION":  "target-revision",
+		"ARGOCD_API_TOKEN":       "api-token",
+		"KPCEA_CA_FILE":          "/etc/kpcea/ca.crt",
+		"KPCEA_CLIENT_CERT_FILE": "/etc/kpcea/tls.crt",
+		"KPCEA_CLIENT_KEY_FILE":  "/etc/kpcea/tls.key",
+	})
+	defer cleanup()
+
+	config, err := LoadConfig()
+
+	assert.NoError(t, err)
+	assert.Equal(t, "/etc/kpcea/ca.crt", config.CAFile)
+	assert.Equal(t, "/etc/kpcea/tls.crt", config.ClientCertFile)
+	assert.Equal(t, "/etc/kpcea/tls.key", config.ClientKeyFile)
+}
+
+func TestLoadConfig_ClientCertFileWithoutKeyFile(t *testing.T) {
+	cleanup := setEnvVars(t, map[string]string{
+		"ARGOCD_SERVER":          "argocd-server",
+		"ARGOCD_APP_NAME":        "argo-app-name",
+		"KPCEA_TARGET_REVISION":  "target-revision",
+		"ARGOCD_API_TOKEN":       "api-token",
+		"KPCEA_CLIENT_CERT_FILE": "/etc/kpcea/tls.crt",
+	})
+	defer cleanup()
+
+	_, err := LoadConfig()
+
+	assert.Error(t, err)
+	assert.Equal(t, "KPCEA_CLIENT_CERT_FILE and KPCEA_CLIENT_KEY_FILE must be set together", err.Error())
+}
+
+func TestLoadConfig_TLSSkipVerifyWithoutPlainText(t *testing.T) {
+	cleanup := setEnvVars(t, map[string]string{
+		"ARGOCD_SERVER":         "argocd-server",
+		"ARGOCD_APP_NAME":       "argo-app-name",
+		"KPCEA_TARGET_REVISION": "target-revision",
+		"ARGOCD_API_TOKEN":      "api-token",
+		"KPCEA_TLS_SKIP_VERIFY": "true",
+	})
+	defer cleanup()
+
+	config, err := LoadConfig()
+
+	assert.NoError(t, err)
+	assert.Equal(t, false, config.PlainText)
+	assert.Equal(t, true, config.TLSSkipVerify)
+}
+
+func TestLoadConfig_PlainTextWithoutTLSSkipVerify(t *testing.T) {
+	cleanup := setEnvVars(t, map[string]string{
+		"ARGOCD_SERVER":         "argocd-server",
+		"ARGOCD_APP_NAME":       "argo-app-name",
+		"KPCEA_TARGET_REVISION": "target-revision",
+		"ARGOCD_API_TOKEN":      "api-token",
+		"KPCEA_PLAINTEXT":       "true",
+	})
+	defer cleanup()
+
+	config, err := LoadConfig()
+
+	assert.NoError(t, err)
+	assert.Equal(t, true, config.PlainText)
+	assert.Equal(t, false, config.TLSSkipVerify)
+}
+
+func TestLoadConfig_UseNativeGRPC(t *testing.T) {
+	cleanup := setEnvVars(t, map[string]string{
+		"ARGOCD_SERVER":         "argocd-server",
+		"ARGOCD_APP_NAME":       "argo-app-name",
+		"KPCEA_TARGET_REVISION": "target-revision",
+		"ARGOCD_API_TOKEN":      "api-token",
+		"KPCEA_USE_GRPC":        "true",
+	})
+	defer cleanup()
+
+	config, err := LoadConfig()
+
+	assert.NoError(t, err)
+	assert.Equal(t, true, config.UseGRPC)
+}
+
+func TestLoadConfig_GRPCWebRootPath(t *testing.T) {
+	cleanup := setEnvVars(t, map[string]string{
+		"ARGOCD_SERVER":            "argocd-server",
+		"ARGOCD_APP_NAME":          "argo-app-name",
+		"KPCEA_TARGET_REVISION":    "target-revision",
+		"ARGOCD_API_TOKEN":         "api-token",
+		"KPCEA_GRPC_WEB_ROOT_PATH": "/argocd/",
+	})
+	defer cleanup()
+
+	config, err := LoadConfig()
+
+	assert.NoError(t, err)
+	assert.Equal(t, false, config.UseGRPC)
+	assert.Equal(t, "argocd", config.GRPCWebRootPath)
+}
+
+func TestLoadConfig_GRPCWebRootPathWithNativeGRPC(t *testing.T) {
+	cleanup := setEnvVars(t, map[string]string{
+		"ARGOCD_SERVER":            "argocd-server",
+		"ARGOCD_APP_NAME":          "argo-app-name",
+		"KPCEA_TARGET_REVISION":    "target-revision",
+		"ARGOCD_API_TOKEN":         "api-token",
+		"KPCEA_USE_GRPC":           "true",
+		"KPCEA_GRPC_WEB_ROOT_PATH": "argocd",
+	})
+	defer cleanup()
+
+	_, err := LoadConfig()
+
+	assert.Error(t, err)
+	assert.Equal(t, "KPCEA_GRPC_WEB_ROOT_PATH can not be used together with KPCEA_USE_GRPC", err.Error())
+}
+
+func TestLoadConfig_ArgoServerURL(t *testing.T) {
+	tests := []struct {
+		server          string
+		host            string
+		basePath        string
+		plainText       bool
+		grpcWebRootPath string
+	}{
+		{"argocd.mydomain.xyz", "argocd.mydomain.xyz", "", false, ""},
+		{"argocd.mydomain.xyz:8443", "argocd.mydomain.xyz:8443", "", false, ""},
+		{"tools.corp.example/argocd", "tools.corp.example", "argocd", false, "argocd"},
+		{"https://tools.corp.example/argocd/", "tools.corp.example", "argocd", false, "argocd"},
+		{"https://tools.corp.example:8443", "tools.corp.example:8443", "", false, ""},
+		{"http://localhost:8080/argocd", "localhost:8080", "argocd", true, "argocd"},
+	}
+	for _, test := range tests {
+		t.Run(test.server, func(t *testing.T) {
+			cleanup := setEnvVars(t, map[string]string{
+				"ARGOCD_SERVER":         test.server,
+				"ARGOCD_APP_NAME":       "argo-app-name",
+				"KPCEA_TARGET_REVISION": "target-revision",
+				"ARGOCD_API_TOKEN":      "api-token",
+			})
+			defer cleanup()
+
+			config, err := LoadConfig()
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.host, config.ArgoServer)
+			assert.Equal(t, test.basePath, config.ArgoBasePath)
+			assert.Equal(t, test.plainText, config.PlainText)
+			assert.Equal(t, test.grpcWebRootPath, config.GRPCWebRootPath)
+		})
+	}
+}
+
+func TestLoadConfig_HttpsArgoServerURLOverridesPlainText(t *testing.T) {
+	cleanup := setEnvVars(t, map[string]string{
+		"ARGOCD_SERVER":         "https://argocd.mydomain.xyz",
+		"ARGOCD_APP_NAME":       "argo-app-name",
+		"KPCEA_TARGET_REVISION": "target-revision",
+		"ARGOCD_API_TOKEN":      "api-token",
+		"KPCEA_PLAINTEXT":       "true",
+	})
+	defer cleanup()
+
+	config, err := LoadConfig()
+
+	assert.NoError(t, err)
+	assert.Equal(t, false, config.PlainText)
+}
+
+func TestLoadConfig_InvalidArgoServerURL(t *testing.T) {
+	cleanup := setEnvVars(t, map[string]string{
+		"ARGOCD_SERVER":         "ftp://argocd.mydomain.xyz",
+		"ARGOCD_APP_NAME":       "argo-app-name",
+		"KPCEA_TARGET_REVISION": "target-revision",
+		"ARGOCD_API_TOKEN":      "api-token",
+	})
+	defer cleanup()
+
+	_, err := LoadConfig()
+
+	assert.Error(t, err)
+	assert.Equal(t, "provided ARGOCD_SERVER must be a host or a http(s) URL", err.Error())
+}
+
+func TestLoadConfig_ArgoServerPathWithNativeGRPC(t *testing.T) {
+	cleanup := setEnvVars(t, map[string]string{
+		"ARGOCD_SERVER":         "https://tools.corp.example/argocd",
+		"ARGOCD_APP_NAME":       "argo-app-name",
+		"KPCEA_TARGET_REVISION": "target-revision",
+		"ARGOCD_API_TOKEN":      "api-token",
+		"KPCEA_USE_GRPC":        "true",
+	})
+	defer cleanup()
+
+	_, err := LoadConfig()
+
+	assert.Error(t, err)
+	assert.Equal(t, "a path in ARGOCD_SERVER can not be used together with KPCEA_USE_GRPC", err.Error())
+}
+
+func TestConfig_ArgoServerWithBasePath(t *testing.T) {
+	assert.Equal(t, "argocd.mydomain.xyz", (&Config{ArgoServer: "argocd.mydomain.xyz"}).ArgoServerWithBasePath())
+	assert.Equal(t, "tools.corp.example/argocd", (&Config{ArgoServer: "tools.corp.example", ArgoBasePath: "argocd"}).ArgoServerWithBasePath())
+}
+
+func TestLoadServerConfig_WithoutAppAndRevision(t *testing.T) {
+	cleanup := setEnvVars(t, map[string]string{
+		"ARGOCD_SERVER":    "argocd-server",
+		"ARGOCD_API_TOKEN": "api-token",
+	})
+	defer cleanup()
+
+	config, err := LoadServerConfig()
+
+	assert.NoError(t, err)
+	assert.Equal(t, "argocd-server", config.ArgoServer)
+	assert.Empty(t, config.ArgoAppNames)
+	assert.Equal(t, ":8080", config.ListenAddress)
+}
+
+func TestLoadServerConfig_MissingArgoServer(t *testing.T) {
+	cleanup := setEnvVars(t, map[string]string{
+		"ARGOCD_API_TOKEN": "api-token",
+	})
+	defer cleanup()
+
+	_, err := LoadServerConfig()
+
+	assert.Error(t, err)
+	assert.Equal(t, "ARGOCD_SERVER and ARGOCD_APP_NAME must be set", err.Error())
+}
+
+func TestLoadCheckConfig_ParamsTakePrecedenceOverEnvVars(t *testing.T) {
+	cleanup := setEnvVars(t, map[string]string{
+		"ARGOCD_SERVER":         "argocd-server",
+		"ARGOCD_API_TOKEN":      "api-token",
+		"KPCEA_TARGET_REVISION": "env-revision",
+		"KPCEA_TIMEOUT":         "60",
+		"KPCEA_LISTEN_ADDRESS":  ":9090",
+	})
+	defer cleanup()
+
+	config, err := LoadCheckConfig(url.Values{
+		"app":      {"team-payments/api"},
+		"revision": {"abc123"},
+		"mode":     {"EXACT"},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"team-payments/api"}, config.ArgoAppNames)
+	assert.Equal(t, Exact, config.VerifyMode)
+	assert.Equal(t, "abc123", config.TargetRevision)
+	assert.Equal(t, 60*time.Second, config.PollTimeout)
+	assert.Equal(t, ":9090", config.ListenAddress)
+}
+
+func TestLoadCheckConfig_MissingApp(t *testing.T) {
+	cleanup := setEnvVars(t, map[string]string{
+		"ARGOCD_SERVER":    "argocd-server",
+		"ARGOCD_API_TOKEN": "api-token",
+	})
+	defer cleanup()
+
+	_, err := LoadCheckConfig(url.Values{"revision": {"abc123"}})
+
+	assert.Error(t, err)
+	assert.Equal(t, "ARGOCD_SERVER and ARGOCD_APP_NAME must be set", err.Error())
+}
+
+func TestLoadCheckConfig_InvalidParam(t *testing.T) {
+	cleanup := setEnvVars(t, map[string]string{
+		"ARGOCD_SERVER":    "argocd-server",
+		"ARGOCD_API_TOKEN": "api-token",
+	})
+	defer cleanup()
+
+	_, err := LoadCheckConfig(url.Values{"app": {"api"}, "mode": {"IMAGES"}, "images": {"repo/api"}})
+
+	assert.Error(t, err)
+	assert.Equal(t, "provided KPCEA_EXPECTED_IMAGES is invalid: image reference 'repo/api' must have a tag or digest", err.Error())
+}
+
+func TestLoadCheckConfig_DoesNotReadCredentials(t *testing.T) {
+	cleanup := setEnvVars(t, map[string]string{
+		"ARGOCD_SERVER":         "argocd-server",
+		"ARGOCD_API_TOKEN_FILE": filepath.Join(t.TempDir(), "rotating"),
+	})
+	defer cleanup()
+
+	config, err := LoadCheckConfig(url.Values{"app": {"api"}, "revision": {"abc123"}})
+
+	assert.NoError(t, err)
+	assert.Equal(t, AuthMode(""), config.AuthMode)
+	assert.Equal(t, "", config.ArgoApiToken)
+	assert.Equal(t, "", config.ArgoApiTokenFile)
+}
+
+func TestPluginCheckParams(t *testing.T) {
+	params, err := PluginCheckParams([]byte(`{"app": "team-payments/api", "mode": "EXACT", "revision": "abc123", "timeout": 300}`))
+
+	assert.NoError(t, err)
+	assert.Equal(t, url.Values{
+		"app":      {"team-payments/api"},
+		"mode":     {"EXACT"},
+		"revision": {"abc123"},
+		"timeout":  {"300"},
+	}, params)
+}
+
+func TestPluginCheckParams_Invalid(t *testing.T) {
+	_, unknownErr := PluginCheckParams([]byte(`{"app": "api", "server": "argocd-server"}`))
+	_, typeErr := PluginCheckParams([]byte(`{"app": "api", "images": ["repo/api:1.4.2"]}`))
+	_, jsonErr := PluginCheckParams([]byte(`app: api`))
+
+	assert.EqualError(t, unknownErr, "provided plugin setting 'server' is not supported")
+	assert.EqualError(t, typeErr, "provided plugin setting 'images' must be a string or a number")
+	assert.ErrorContains(t, jsonErr, "provided plugin configuration is invalid")
 }
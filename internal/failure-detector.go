@@ -0,0 +1,95 @@
+package internal
+
+import (
+	"fmt"
+	"github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	"github.com/argoproj/gitops-engine/pkg/health"
+	synccommon "github.com/argoproj/gitops-engine/pkg/sync/common"
+	"log/slog"
+	"time"
+)
+
+// FailureDetector reports a terminal failure once the Argo app has been failing for longer than the grace period.
+// This prevents KPCEA from waiting for the full timeout when the app will not recover on its own.
+type FailureDetector struct {
+	grace  time.Duration
+	since  time.Time
+	reason string
+	logger *slog.Logger
+	now    Clock
+}
+
+func NewFailureDetector(grace time.Duration, now Clock, logger *slog.Logger) *FailureDetector {
+	return &FailureDetector{
+		grace:  grace,
+		logger: logger,
+		now:    now,
+	}
+}
+
+// Check returns the failure reason when the app has kept failing for the whole grace period.
+// The grace period restarts whenever the app is seen in a non-failing state.
+func (d *FailureDetector) Check(argoApp *v1alpha1.Application, targetRevision string) (string, bool) {
+	reason := TerminalFailure(argoApp, targetRevision)
+	if reason == "" {
+		d.reason = ""
+		return "", false
+	}
+	if d.reason == "" {
+		d.since = d.now()
+	}
+	d.reason = reason
+	if d.now().Sub(d.since) < d.grace {
+		d.logger.Warn("App is failing, waiting for it to recover", "reason", reason, "remaining", d.grace-d.now().Sub(d.since))
+		return "", false
+	}
+	return reason, true
+}
+
+// TerminalFailure describes why the app is in a failed state, or returns an empty string when it is not.
+// A failed sync operation only counts when it was performed for the target revision.
+// Without a target revision, the operation must be for the revision that ArgoCD currently wants to sync.
+// A Degraded app only counts when it is synced to the target revision, a promotion can fix an app that is Degraded on its old revision.
+func TerminalFailure(argoApp *v1alpha1.Application, targetRevision string) string {
+	if reason := failedOperation(argoApp, targetRevision); reason != "" {
+		return reason
+	}
+	if argoApp.Status.Health.Status == health.HealthStatusDegraded && (targetRevision == "" || RevisionMatches(targetRevision, argoApp.Status.Sync.Revision)) {
+		if argoApp.Status.Health.Message != "" {
+			return fmt.Sprintf("app health is Degraded: %s", argoApp.Status.Health.Message)
+		}
+		return "app health is Degraded"
+	}
+	return ""
+}
+
+func failedOperation(argoApp *v1alpha1.Application, targetRevision string) string {
+	operationState := argoApp.Status.OperationState
+	if argoApp.Operation != nil || operationState == nil {
+		return ""
+	}
+	if operationState.Phase != synccommon.OperationFailed && operationState.Phase != synccommon.OperationError {
+		return ""
+	}
+
+	// Compare against both the resolved and the requested revision, so tags and branches match as well
+	var operationRevisions []string
+	if operationState.SyncResult != nil && operationState.SyncResult.Revision != "" {
+		operationRevisions = append(operationRevisions, operationState.SyncResult.Revision)
+	}
+	if operationState.Operation.Sync != nil && operationState.Operation.Sync.Revision != "" {
+		operationRevisions = append(operationRevisions, operationState.Operation.Sync.Revision)
+	}
+	if targetRevision == "" {
+		targetRevision = argoApp.Status.Sync.Revision
+	}
+	if len(operationRevisions) == 0 {
+		return fmt.Sprintf("sync operation failed: %s", operationState.Message)
+	}
+	for _, operationRevision := range operationRevisions {
+		if targetRevision == "" || RevisionMatches(targetRevision, operationRevision) {
+			return fmt.Sprintf("sync operation for %s failed: %s", operationRevisions[0], operationState.Message)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,118 @@
+package internal
+
+import (
+	"github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	"github.com/argoproj/gitops-engine/pkg/health"
+	synccommon "github.com/argoproj/gitops-engine/pkg/sync/common"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func newFailedSyncApp(resolved string, requested string, message string) *v1alpha1.Application {
+	app := &v1alpha1.Application{}
+	app.Status.Health.Status = health.HealthStatusProgressing
+	app.Status.OperationState = &v1alpha1.OperationState{
+		Phase:      synccommon.OperationFailed,
+		Message:    message,
+		Operation:  v1alpha1.Operation{Sync: &v1alpha1.SyncOperation{Revision: requested}},
+		SyncResult: &v1alpha1.SyncOperationResult{Revision: resolved},
+	}
+	return app
+}
+
+func newDegradedApp(message string) *v1alpha1.Application {
+	app := &v1alpha1.Application{}
+	app.Status.Sync.Revision = "abc123"
+	app.Status.Health = v1alpha1.HealthStatus{Status: health.HealthStatusDegraded, Message: message}
+	return app
+}
+
+func TestTerminalFailure(t *testing.T) {
+	errorApp := newFailedSyncApp("abc123", "", "unable to reach repository")
+	errorApp.Status.OperationState.Phase = synccommon.OperationError
+	retryingApp := newFailedSyncApp("abc123", "", "retrying")
+	retryingApp.Operation = &v1alpha1.Operation{Sync: &v1alpha1.SyncOperation{}}
+	unresolvedApp := newFailedSyncApp("", "", "comparison error")
+	unresolvedApp.Status.OperationState.SyncResult = nil
+	healthyApp := &v1alpha1.Application{}
+	healthyApp.Status.Health.Status = health.HealthStatusHealthy
+	syncingToOldApp := newFailedSyncApp("abc123", "", "failed")
+	syncingToOldApp.Status.Sync.Revision = "def456"
+	syncingToFailedApp := newFailedSyncApp("abc123", "", "failed")
+	syncingToFailedApp.Status.Sync.Revision = "abc123"
+	degradedOnOldApp := newDegradedApp("")
+	degradedOnOldApp.Status.Sync.Revision = "def456"
+
+	tests := []struct {
+		name           string
+		app            *v1alpha1.Application
+		targetRevision string
+		reason         string
+	}{
+		{"healthy", healthyApp, "abc123", ""},
+		{"failed for target revision", newFailedSyncApp("abc123", "", "one or more objects failed to apply"), "abc123", "sync operation for abc123 failed: one or more objects failed to apply"},
+		{"failed for short target revision", newFailedSyncApp("3f2a9c1d8e7b6a5f4e3d2c1b0a9f8e7d6c5b4a39", "", "failed"), "3f2a9c1", "sync operation for 3f2a9c1d8e7b6a5f4e3d2c1b0a9f8e7d6c5b4a39 failed: failed"},
+		{"failed for requested tag", newFailedSyncApp("abc123", "v1.8.0", "failed"), "v1.8.0", "sync operation for abc123 failed: failed"},
+		{"failed for other revision", newFailedSyncApp("def456", "", "failed"), "abc123", ""},
+		{"errored", errorApp, "abc123", "sync operation for abc123 failed: unable to reach repository"},
+		{"still retrying", retryingApp, "abc123", ""},
+		{"failed without revision", unresolvedApp, "abc123", "sync operation failed: comparison error"},
+		{"failed for revision argo moved away from", syncingToOldApp, "", ""},
+		{"failed for revision argo wants to sync", syncingToFailedApp, "", "sync operation for abc123 failed: failed"},
+		{"degraded", newDegradedApp("Deployment \"api\" exceeded its progress deadline"), "abc123", "app health is Degraded: Deployment \"api\" exceeded its progress deadline"},
+		{"degraded without message", newDegradedApp(""), "", "app health is Degraded"},
+		{"degraded on other revision", degradedOnOldApp, "abc123", ""},
+		{"degraded on other revision without target revision", degradedOnOldApp, "", "app health is Degraded"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.reason, TerminalFailure(test.app, test.targetRevision))
+		})
+	}
+}
+
+func TestFailureDetector_Check_WaitsForGracePeriod(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	detector := NewFailureDetector(30*time.Second, func() time.Time { return now }, testLogger)
+	degradedApp := newDegradedApp("")
+
+	_, failedAtStart := detector.Check(degradedApp, "")
+	now = now.Add(29 * time.Second)
+	_, failedWithinGrace := detector.Check(degradedApp, "")
+	now = now.Add(time.Second)
+	reason, failedAfterGrace := detector.Check(degradedApp, "")
+
+	assert.False(t, failedAtStart)
+	assert.False(t, failedWithinGrace)
+	assert.True(t, failedAfterGrace)
+	assert.Equal(t, "app health is Degraded", reason)
+}
+
+func TestFailureDetector_Check_RecoveryRestartsGracePeriod(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	detector := NewFailureDetector(30*time.Second, func() time.Time { return now }, testLogger)
+	healthyApp := &v1alpha1.Application{}
+	healthyApp.Status.Health.Status = health.HealthStatusHealthy
+
+	_, _ = detector.Check(newDegradedApp(""), "")
+	now = now.Add(20 * time.Second)
+	_, failedWhenRecovered := detector.Check(healthyApp, "")
+	now = now.Add(time.Second)
+	_, failedAgain := detector.Check(newDegradedApp(""), "")
+	now = now.Add(20 * time.Second)
+	_, failedWithinNewGrace := detector.Check(newDegradedApp(""), "")
+
+	assert.False(t, failedWhenRecovered)
+	assert.False(t, failedAgain)
+	assert.False(t, failedWithinNewGrace)
+}
+
+func TestFailureDetector_Check_WithoutGracePeriod(t *testing.T) {
+	detector := NewFailureDetector(0, time.Now, testLogger)
+
+	reason, failed := detector.Check(newFailedSyncApp("abc123", "", "one or more objects failed to apply"), "abc123")
+
+	assert.True(t, failed)
+	assert.Equal(t, "sync operation for abc123 failed: one or more objects failed to apply", reason)
+}
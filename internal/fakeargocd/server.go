@@ -0,0 +1,338 @@
+package fakeargocd
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/argoproj/argo-cd/v2/pkg/apiclient/application"
+	"github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	"github.com/argoproj/gitops-engine/pkg/health"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"io"
+	"k8s.io/apimachinery/pkg/watch"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const (
+	frameHeaderLength = 5
+	endOfStreamFlag   = 128
+)
+
+// Server is an in-process ArgoCD API server for tests.
+// It serves the ApplicationService over gRPC and gRPC-web, and the session endpoint to log in, on a single plain text address.
+// The state of an app is scripted: every Get and every Watch event moves the app to its next state.
+type Server struct {
+	application.UnimplementedApplicationServiceServer
+	// Addr is the host and port to use as ARGOCD_SERVER, the server only accepts plain text connections
+	Addr string
+
+	mu           sync.Mutex
+	token        string
+	username     string
+	password     string
+	apps         map[string][]*v1alpha1.Application
+	revisions    map[string]*v1alpha1.RevisionMetadata
+	syncRequests []*application.ApplicationSyncRequest
+
+	grpcServer *grpc.Server
+	httpServer *http.Server
+	conn       *grpc.ClientConn
+}
+
+// NewServer starts a server on a random local port, that only accepts requests with the given API token.
+func NewServer(token string) (*Server, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		Addr:      listener.Addr().String(),
+		token:     token,
+		apps:      map[string][]*v1alpha1.Application{},
+		revisions: map[string]*v1alpha1.RevisionMetadata{},
+	}
+	s.grpcServer = grpc.NewServer(grpc.UnaryInterceptor(s.authenticateUnary), grpc.StreamInterceptor(s.authenticateStream))
+	application.RegisterApplicationServiceServer(s.grpcServer, s)
+
+	// gRPC-web requests are translated to gRPC requests to the server itself
+	s.conn, err = grpc.NewClient(s.Addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		_ = listener.Close()
+		return nil, err
+	}
+
+	var protocols http.Protocols
+	protocols.SetHTTP1(true)
+	protocols.SetUnencryptedHTTP2(true)
+	s.httpServer = &http.Server{Handler: http.HandlerFunc(s.serveHTTP), Protocols: &protocols}
+	go func() {
+		_ = s.httpServer.Serve(listener)
+	}()
+	return s, nil
+}
+
+// Close stops the server and closes all open streams.
+func (s *Server) Close() {
+	_ = s.conn.Close()
+	s.grpcServer.Stop()
+	_ = s.httpServer.Close()
+}
+
+// SetToken changes the API token that the server accepts, like ArgoCD does when a token is rotated.
+func (s *Server) SetToken(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.token = token
+}
+
+// SetLogin sets the credentials that the session endpoint exchanges for the API token.
+func (s *Server) SetLogin(username string, password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.username = username
+	s.password = password
+}
+
+// ScriptApp sets the states that the app goes through. The app stays in the last state.
+func (s *Server) ScriptApp(name string, states ...*v1alpha1.Application) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.apps[name] = states
+}
+
+// SetRevisionMetadata sets the metadata, like the commit message, that is returned for a revision.
+func (s *Server) SetRevisionMetadata(revision string, revisionMetadata *v1alpha1.RevisionMetadata) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.revisions[revision] = revisionMetadata
+}
+
+// SyncRequests returns the sync requests that the server received.
+func (s *Server) SyncRequests() []*application.ApplicationSyncRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*application.ApplicationSyncRequest{}, s.syncRequests...)
+}
+
+// App creates the state of an app with the sync status, health status and synced revision.
+func App(name string, syncStatus v1alpha1.SyncStatusCode, healthStatus health.HealthStatusCode, revision string) *v1alpha1.Application {
+	app := &v1alpha1.Application{
+		Status: v1alpha1.ApplicationStatus{
+			Sync:   v1alpha1.SyncStatus{Status: syncStatus, Revision: revision},
+			Health: v1alpha1.HealthStatus{Status: healthStatus},
+		},
+	}
+	app.Name = name
+	return app
+}
+
+func (s *Server) Get(_ context.Context, in *application.ApplicationQuery) (*v1alpha1.Application, error) {
+	return s.nextState(in.GetName())
+}
+
+func (s *Server) Watch(in *application.ApplicationQuery, stream application.ApplicationService_WatchServer) error {
+	for {
+		app, last, err := s.nextWatchState(in.GetName())
+		if err != nil {
+			return err
+		}
+		if err = stream.Send(&v1alpha1.ApplicationWatchEvent{Type: watch.Modified, Application: *app}); err != nil {
+			return err
+		}
+		if last {
+			<-stream.Context().Done()
+			return nil
+		}
+	}
+}
+
+func (s *Server) Sync(_ context.Context, in *application.ApplicationSyncRequest) (*v1alpha1.Application, error) {
+	s.mu.Lock()
+	s.syncRequests = append(s.syncRequests, in)
+	states, found := s.apps[in.GetName()]
+	s.mu.Unlock()
+	if !found {
+		return nil, notFound(in.GetName())
+	}
+	return states[0], nil
+}
+
+func (s *Server) RevisionMetadata(_ context.Context, in *application.RevisionMetadataQuery) (*v1alpha1.RevisionMetadata, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	revisionMetadata, found := s.revisions[in.GetRevision()]
+	if !found {
+		return nil, status.Errorf(codes.NotFound, "revision %s not found", in.GetRevision())
+	}
+	return revisionMetadata, nil
+}
+
+// nextState returns the current state of the app, and moves the app to its next state.
+func (s *Server) nextState(name string) (*v1alpha1.Application, error) {
+	app, _, err := s.nextWatchState(name)
+	return app, err
+}
+
+// nextWatchState returns the current state of the app, and whether it is the last state.
+func (s *Server) nextWatchState(name string) (*v1alpha1.Application, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	states, found := s.apps[name]
+	if !found {
+		return nil, false, notFound(name)
+	}
+	if len(states) > 1 {
+		s.apps[name] = states[1:]
+	}
+	return states[0], len(states) == 1, nil
+}
+
+func notFound(name string) error {
+	return status.Errorf(codes.NotFound, "applications.argoproj.io \"%s\" not found", name)
+}
+
+func (s *Server) authenticate(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	md, _ := metadata.FromIncomingContext(ctx)
+	tokens := md.Get("token")
+	if len(tokens) == 0 || tokens[0] != s.token {
+		return status.Error(codes.Unauthenticated, "invalid session: token is not valid")
+	}
+	return nil
+}
+
+func (s *Server) authenticateUnary(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if err := s.authenticate(ctx); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *Server) authenticateStream(srv any, stream grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := s.authenticate(stream.Context()); err != nil {
+		return err
+	}
+	return handler(srv, stream)
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	contentType := r.Header.Get("Content-Type")
+	switch {
+	case r.URL.Path == "/api/v1/session":
+		s.serveSession(w, r)
+	case strings.HasPrefix(contentType, "application/grpc-web"):
+		s.serveGRPCWeb(w, r)
+	case r.ProtoMajor == 2 && strings.HasPrefix(contentType, "application/grpc"):
+		s.grpcServer.ServeHTTP(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// serveSession exchanges the username and password for the API token.
+func (s *Server) serveSession(w http.ResponseWriter, r *http.Request) {
+	var login struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&login); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	valid := s.username != "" && login.Username == s.username && login.Password == s.password
+	token := s.token
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if !valid {
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = json.NewEncoder(w).Encode(map[string]any{"error": "Invalid username or password", "code": 16, "message": "Invalid username or password"})
+		return
+	}
+	_ = json.NewEncoder(w).Encode(map[string]string{"token": token})
+}
+
+// serveGRPCWeb performs a gRPC-web request as a gRPC request, and writes the responses as gRPC-web frames.
+// An error before the first response is returned in the headers, which is where the ArgoCD client expects it.
+func (s *Server) serveGRPCWeb(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil || len(body) < frameHeaderLength {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	message := body[frameHeaderLength:]
+
+	md := metadata.MD{}
+	if token := r.Header.Get("token"); token != "" {
+		md.Set("token", token)
+	}
+	ctx := metadata.NewOutgoingContext(r.Context(), md)
+	stream, err := s.conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, r.URL.Path, grpc.ForceCodec(rawCodec{}))
+	if err == nil {
+		err = stream.SendMsg(message)
+	}
+	if err == nil {
+		err = stream.CloseSend()
+	}
+	var response []byte
+	if err == nil {
+		err = stream.RecvMsg(&response)
+	}
+	if err != nil {
+		grpcStatus := status.Convert(err)
+		w.Header().Set("Grpc-Status", fmt.Sprint(int(grpcStatus.Code())))
+		w.Header().Set("Grpc-Message", grpcStatus.Message())
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/grpc-web+proto")
+	w.WriteHeader(http.StatusOK)
+	for err == nil {
+		_, _ = w.Write(frame(0, response))
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+		err = stream.RecvMsg(&response)
+	}
+	grpcStatus := status.Convert(err)
+	if errors.Is(err, io.EOF) {
+		grpcStatus = status.New(codes.OK, "")
+	}
+	trailer := fmt.Sprintf("grpc-status: %d\r\ngrpc-message: %s\r\n", grpcStatus.Code(), grpcStatus.Message())
+	_, _ = w.Write(frame(endOfStreamFlag, []byte(trailer)))
+}
+
+// rawCodec passes the encoded messages through, since the gRPC-web request already holds the encoded message.
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v any) ([]byte, error) {
+	return v.([]byte), nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v any) error {
+	*(v.(*[]byte)) = data
+	return nil
+}
+
+func (rawCodec) Name() string {
+	return "proto"
+}
+
+func frame(flag byte, message []byte) []byte {
+	header := make([]byte, frameHeaderLength)
+	header[0] = flag
+	binary.BigEndian.PutUint32(header[1:], uint32(len(message)))
+	return append(header, message...)
+}
@@ -0,0 +1,122 @@
+package fakeargocd
+
+import (
+	"context"
+	"github.com/argoproj/argo-cd/v2/pkg/apiclient"
+	"github.com/argoproj/argo-cd/v2/pkg/apiclient/application"
+	"github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	"github.com/argoproj/gitops-engine/pkg/health"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"testing"
+)
+
+func startServer(t *testing.T) *Server {
+	t.Helper()
+	server, err := NewServer("api-token")
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newAppClient(t *testing.T, server *Server, token string, grpcWeb bool) application.ApplicationServiceClient {
+	t.Helper()
+	apiClient, err := apiclient.NewClient(&apiclient.ClientOptions{
+		ServerAddr: server.Addr,
+		AuthToken:  token,
+		PlainText:  true,
+		GRPCWeb:    grpcWeb,
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	closer, appClient, err := apiClient.NewApplicationClient()
+	if err != nil {
+		t.Fatalf("failed to create application client: %v", err)
+	}
+	t.Cleanup(func() { _ = closer.Close() })
+	return appClient
+}
+
+func TestServer_Get_ScriptedStates(t *testing.T) {
+	for _, grpcWeb := range []bool{true, false} {
+		server := startServer(t)
+		server.ScriptApp("api",
+			App("api", v1alpha1.SyncStatusCodeOutOfSync, health.HealthStatusProgressing, "abc123"),
+			App("api", v1alpha1.SyncStatusCodeSynced, health.HealthStatusHealthy, "def456"),
+		)
+		client := newAppClient(t, server, "api-token", grpcWeb)
+		name := "api"
+
+		first, firstErr := client.Get(context.Background(), &application.ApplicationQuery{Name: &name})
+		second, secondErr := client.Get(context.Background(), &application.ApplicationQuery{Name: &name})
+		third, thirdErr := client.Get(context.Background(), &application.ApplicationQuery{Name: &name})
+
+		assert.NoError(t, firstErr)
+		assert.Equal(t, v1alpha1.SyncStatusCodeOutOfSync, first.Status.Sync.Status)
+		assert.NoError(t, secondErr)
+		assert.Equal(t, "def456", second.Status.Sync.Revision)
+		assert.NoError(t, thirdErr)
+		assert.Equal(t, health.HealthStatusHealthy, third.Status.Health.Status)
+	}
+}
+
+func TestServer_Get_Errors(t *testing.T) {
+	for _, grpcWeb := range []bool{true, false} {
+		server := startServer(t)
+		server.ScriptApp("api", App("api", v1alpha1.SyncStatusCodeSynced, health.HealthStatusHealthy, "abc123"))
+		name := "other"
+
+		_, notFoundErr := newAppClient(t, server, "api-token", grpcWeb).Get(context.Background(), &application.ApplicationQuery{Name: &name})
+		_, invalidTokenErr := newAppClient(t, server, "invalid-token", grpcWeb).Get(context.Background(), &application.ApplicationQuery{Name: &name})
+
+		assert.Equal(t, codes.NotFound, status.Code(notFoundErr))
+		assert.Equal(t, codes.Unauthenticated, status.Code(invalidTokenErr))
+	}
+}
+
+func TestServer_Watch(t *testing.T) {
+	server := startServer(t)
+	server.ScriptApp("api",
+		App("api", v1alpha1.SyncStatusCodeOutOfSync, health.HealthStatusProgressing, "abc123"),
+		App("api", v1alpha1.SyncStatusCodeSynced, health.HealthStatusHealthy, "abc123"),
+	)
+	client := newAppClient(t, server, "api-token", true)
+	name := "api"
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream, err := client.Watch(ctx, &application.ApplicationQuery{Name: &name})
+	assert.NoError(t, err)
+	first, firstErr := stream.Recv()
+	second, secondErr := stream.Recv()
+
+	assert.NoError(t, firstErr)
+	assert.Equal(t, v1alpha1.SyncStatusCodeOutOfSync, first.Application.Status.Sync.Status)
+	assert.NoError(t, secondErr)
+	assert.Equal(t, v1alpha1.SyncStatusCodeSynced, second.Application.Status.Sync.Status)
+}
+
+func TestServer_SyncAndRevisionMetadata(t *testing.T) {
+	server := startServer(t)
+	server.ScriptApp("api", App("api", v1alpha1.SyncStatusCodeSynced, health.HealthStatusHealthy, "abc123"))
+	server.SetRevisionMetadata("abc123", &v1alpha1.RevisionMetadata{Message: "chore: promote api to v1.4.2"})
+	client := newAppClient(t, server, "api-token", true)
+	name := "api"
+	revision := "abc123"
+	unknownRevision := "def456"
+
+	_, syncErr := client.Sync(context.Background(), &application.ApplicationSyncRequest{Name: &name, Revision: &revision})
+	revisionMetadata, metadataErr := client.RevisionMetadata(context.Background(), &application.RevisionMetadataQuery{Name: &name, Revision: &revision})
+	_, unknownErr := client.RevisionMetadata(context.Background(), &application.RevisionMetadataQuery{Name: &name, Revision: &unknownRevision})
+
+	assert.NoError(t, syncErr)
+	assert.Len(t, server.SyncRequests(), 1)
+	assert.Equal(t, "abc123", server.SyncRequests()[0].GetRevision())
+	assert.NoError(t, metadataErr)
+	assert.Equal(t, "chore: promote api to v1.4.2", revisionMetadata.Message)
+	assert.Equal(t, codes.NotFound, status.Code(unknownErr))
+}
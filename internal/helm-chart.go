@@ -0,0 +1,50 @@
+package internal
+
+import (
+	"fmt"
+	"github.com/Masterminds/semver/v3"
+	"github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+)
+
+// HelmChart is a chart from a Helm repository source, with the version ArgoCD synced it to.
+type HelmChart struct {
+	Chart   string
+	RepoURL string
+	Version string
+}
+
+// FindHelmChart returns the Helm repository source of the Argo app, together with its synced chart version.
+// When the app has multiple chart sources, chartName selects one of them. Otherwise, the first chart source is used.
+func FindHelmChart(app *v1alpha1.Application, chartName string) (*HelmChart, error) {
+	sources := app.Spec.GetSources()
+	syncedRevisions := app.Status.Sync.Revisions
+	if !app.Spec.HasMultipleSources() {
+		syncedRevisions = []string{app.Status.Sync.Revision}
+	}
+
+	for i, source := range sources {
+		if source.Chart == "" || (chartName != "" && source.Chart != chartName) {
+			continue
+		}
+		chart := &HelmChart{Chart: source.Chart, RepoURL: source.RepoURL}
+		if i < len(syncedRevisions) {
+			chart.Version = syncedRevisions[i]
+		}
+		return chart, nil
+	}
+
+	if chartName != "" {
+		return nil, fmt.Errorf("app has no Helm repository source for chart '%s'", chartName)
+	}
+	return nil, fmt.Errorf("app has no Helm repository source")
+}
+
+// ChartVersionSatisfies checks the synced chart version against a semver constraint.
+// A leading "v" in the version is accepted, so "v1.4.2" and "1.4.2" are treated the same.
+func ChartVersionSatisfies(constraint *semver.Constraints, version string) (bool, error) {
+	parsed, err := semver.NewVersion(version)
+	if err != nil {
+		return false, fmt.Errorf("chart version '%s' is not a valid semver: %v", version, err)
+	}
+	return constraint.Check(parsed), nil
+}
@@ -0,0 +1,91 @@
+package internal
+
+import (
+	"github.com/Masterminds/semver/v3"
+	"github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestFindHelmChart_SingleSourceApp(t *testing.T) {
+	app := &v1alpha1.Application{
+		Spec:   v1alpha1.ApplicationSpec{Source: &v1alpha1.ApplicationSource{RepoURL: "https://charts.example.com", Chart: "api"}},
+		Status: v1alpha1.ApplicationStatus{Sync: v1alpha1.SyncStatus{Revision: "1.4.2"}},
+	}
+
+	chart, err := FindHelmChart(app, "")
+
+	assert.NoError(t, err)
+	assert.Equal(t, &HelmChart{Chart: "api", RepoURL: "https://charts.example.com", Version: "1.4.2"}, chart)
+}
+
+func TestFindHelmChart_MultiSourceAppByName(t *testing.T) {
+	app := &v1alpha1.Application{
+		Spec: v1alpha1.ApplicationSpec{Sources: v1alpha1.ApplicationSources{
+			{RepoURL: "https://github.com/org/values", Ref: "values"},
+			{RepoURL: "https://charts.example.com", Chart: "api"},
+			{RepoURL: "https://charts.example.com", Chart: "worker"},
+		}},
+		Status: v1alpha1.ApplicationStatus{Sync: v1alpha1.SyncStatus{Revisions: []string{"abc123", "1.4.2", "2.0.1"}}},
+	}
+
+	first, firstErr := FindHelmChart(app, "")
+	worker, workerErr := FindHelmChart(app, "worker")
+
+	assert.NoError(t, firstErr)
+	assert.Equal(t, "api", first.Chart)
+	assert.Equal(t, "1.4.2", first.Version)
+	assert.NoError(t, workerErr)
+	assert.Equal(t, "worker", worker.Chart)
+	assert.Equal(t, "2.0.1", worker.Version)
+}
+
+func TestFindHelmChart_NoHelmSource(t *testing.T) {
+	app := &v1alpha1.Application{
+		Spec: v1alpha1.ApplicationSpec{Source: &v1alpha1.ApplicationSource{RepoURL: "https://github.com/org/app"}},
+	}
+
+	_, err := FindHelmChart(app, "")
+	_, namedErr := FindHelmChart(app, "api")
+
+	assert.Error(t, err)
+	assert.Equal(t, "app has no Helm repository source", err.Error())
+	assert.Error(t, namedErr)
+	assert.Equal(t, "app has no Helm repository source for chart 'api'", namedErr.Error())
+}
+
+func TestChartVersionSatisfies(t *testing.T) {
+	tests := []struct {
+		constraint string
+		version    string
+		satisfied  bool
+	}{
+		{"=1.4.2", "1.4.2", true},
+		{"=1.4.2", "v1.4.2", true},
+		{"=v1.4.2", "1.4.2", true},
+		{"=1.4.2", "1.4.3", false},
+		{">=1.4.0 <2.0.0", "1.9.9", true},
+		{">=1.4.0 <2.0.0", "2.0.0", false},
+		{">=1.4.0 <2.0.0", "1.3.0", false},
+	}
+	for _, test := range tests {
+		t.Run(test.constraint+"/"+test.version, func(t *testing.T) {
+			constraint, _ := semver.NewConstraint(test.constraint)
+
+			satisfied, err := ChartVersionSatisfies(constraint, test.version)
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.satisfied, satisfied)
+		})
+	}
+}
+
+func TestChartVersionSatisfies_InvalidVersion(t *testing.T) {
+	constraint, _ := semver.NewConstraint(">=1.0.0")
+
+	satisfied, err := ChartVersionSatisfies(constraint, "latest")
+
+	assert.Error(t, err)
+	assert.False(t, satisfied)
+	assert.Equal(t, "chart version 'latest' is not a valid semver: Invalid Semantic Version", err.Error())
+}
@@ -0,0 +1,120 @@
+package internal
+
+import (
+	"fmt"
+	"github.com/Masterminds/semver/v3"
+	"strings"
+)
+
+const minVersionPrefix = ">="
+
+// ExpectedImage is a container image that must be deployed by the Argo app.
+// It is matched by exact tag, by digest, or by a minimal semver tag.
+type ExpectedImage struct {
+	Repository string
+	Tag        string
+	Digest     string
+	MinVersion *semver.Version
+}
+
+func (i ExpectedImage) String() string {
+	switch {
+	case i.Digest != "":
+		return i.Repository + "@" + i.Digest
+	case i.MinVersion != nil:
+		return i.Repository + ":" + minVersionPrefix + i.MinVersion.Original()
+	default:
+		return i.Repository + ":" + i.Tag
+	}
+}
+
+// ParseExpectedImages parses a comma-separated list of image references.
+// Supported formats are "repo/name:tag", "repo/name@sha256:digest" and "repo/name:>=1.2.3".
+func ParseExpectedImages(value string) ([]ExpectedImage, error) {
+	var images []ExpectedImage
+	for _, ref := range strings.Split(value, ",") {
+		ref = strings.TrimSpace(ref)
+		if ref == "" {
+			continue
+		}
+		image, err := parseExpectedImage(ref)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, image)
+	}
+	if len(images) == 0 {
+		return nil, fmt.Errorf("no image references provided")
+	}
+	return images, nil
+}
+
+func parseExpectedImage(ref string) (ExpectedImage, error) {
+	repository, tag, digest := splitImageReference(ref)
+	if repository == "" {
+		return ExpectedImage{}, fmt.Errorf("image reference '%s' has no repository", ref)
+	}
+	if digest != "" {
+		return ExpectedImage{Repository: repository, Digest: digest}, nil
+	}
+	if tag == "" {
+		return ExpectedImage{}, fmt.Errorf("image reference '%s' must have a tag or digest", ref)
+	}
+	if strings.HasPrefix(tag, minVersionPrefix) {
+		minVersion, err := semver.NewVersion(strings.TrimPrefix(tag, minVersionPrefix))
+		if err != nil {
+			return ExpectedImage{}, fmt.Errorf("image reference '%s' has an invalid semver: %v", ref, err)
+		}
+		return ExpectedImage{Repository: repository, MinVersion: minVersion}, nil
+	}
+	return ExpectedImage{Repository: repository, Tag: tag}, nil
+}
+
+// splitImageReference splits an image reference into repository, tag and digest.
+// A colon only marks a tag when it comes after the last slash, so registry ports are kept in the repository.
+func splitImageReference(ref string) (string, string, string) {
+	repository, digest, _ := strings.Cut(ref, "@")
+	tag := ""
+	if i := strings.LastIndex(repository, ":"); i > strings.LastIndex(repository, "/") {
+		tag = repository[i+1:]
+		repository = repository[:i]
+	}
+	return repository, tag, digest
+}
+
+// MissingImages returns the expected images that are not found among the deployed images.
+func MissingImages(expected []ExpectedImage, deployed []string) []ExpectedImage {
+	var missing []ExpectedImage
+	for _, image := range expected {
+		found := false
+		for _, ref := range deployed {
+			if image.matches(ref) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, image)
+		}
+	}
+	return missing
+}
+
+func (i ExpectedImage) matches(ref string) bool {
+	repository, tag, digest := splitImageReference(ref)
+	if repository != i.Repository {
+		return false
+	}
+	switch {
+	case i.Digest != "":
+		return digest == i.Digest
+	case i.MinVersion != nil:
+		version, err := semver.NewVersion(tag)
+		if err != nil {
+			return false
+		}
+		return !version.LessThan(i.MinVersion)
+	default:
+		return tag == i.Tag
+	}
+}
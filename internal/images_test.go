@@ -0,0 +1,104 @@
+package internal
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+const apiDigest = "sha256:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+
+func TestParseExpectedImages_TagDigestAndMinVersion(t *testing.T) {
+	images, err := ParseExpectedImages("repo/api:1.4.2, repo/worker@" + apiDigest + ",repo/cron:>=v1.4.0")
+
+	assert.NoError(t, err)
+	assert.Len(t, images, 3)
+	assert.Equal(t, ExpectedImage{Repository: "repo/api", Tag: "1.4.2"}, images[0])
+	assert.Equal(t, ExpectedImage{Repository: "repo/worker", Digest: apiDigest}, images[1])
+	assert.Equal(t, "repo/cron", images[2].Repository)
+	assert.Equal(t, "1.4.0", images[2].MinVersion.String())
+	assert.Equal(t, "repo/cron:>=v1.4.0", images[2].String())
+}
+
+func TestParseExpectedImages_RegistryWithPort(t *testing.T) {
+	images, err := ParseExpectedImages("registry.local:5000/repo/api:1.4.2")
+
+	assert.NoError(t, err)
+	assert.Equal(t, ExpectedImage{Repository: "registry.local:5000/repo/api", Tag: "1.4.2"}, images[0])
+}
+
+func TestParseExpectedImages_MissingTag(t *testing.T) {
+	_, err := ParseExpectedImages("registry.local:5000/repo/api")
+
+	assert.Error(t, err)
+	assert.Equal(t, "image reference 'registry.local:5000/repo/api' must have a tag or digest", err.Error())
+}
+
+func TestParseExpectedImages_MissingRepository(t *testing.T) {
+	_, err := ParseExpectedImages(":1.4.2")
+
+	assert.Error(t, err)
+	assert.Equal(t, "image reference ':1.4.2' has no repository", err.Error())
+}
+
+func TestParseExpectedImages_InvalidMinVersion(t *testing.T) {
+	_, err := ParseExpectedImages("repo/api:>=latest")
+
+	assert.Error(t, err)
+	assert.Equal(t, "image reference 'repo/api:>=latest' has an invalid semver: Invalid Semantic Version", err.Error())
+}
+
+func TestParseExpectedImages_OnlySeparators(t *testing.T) {
+	_, err := ParseExpectedImages(" , ")
+
+	assert.Error(t, err)
+	assert.Equal(t, "no image references provided", err.Error())
+}
+
+func TestMissingImages_AllDeployed(t *testing.T) {
+	expected, _ := ParseExpectedImages("repo/api:1.4.2,repo/worker@" + apiDigest + ",repo/cron:>=1.4.0")
+	deployed := []string{
+		"repo/api:1.4.2",
+		"repo/worker:1.4.2@" + apiDigest,
+		"repo/cron:v1.10.0",
+		"redis:7",
+	}
+
+	missing := MissingImages(expected, deployed)
+
+	assert.Empty(t, missing)
+}
+
+func TestMissingImages_WrongTag(t *testing.T) {
+	expected, _ := ParseExpectedImages("repo/api:1.4.2,repo/worker:1.4.2")
+	deployed := []string{"repo/api:1.4.2", "repo/worker:1.4.1"}
+
+	missing := MissingImages(expected, deployed)
+
+	assert.Equal(t, []ExpectedImage{{Repository: "repo/worker", Tag: "1.4.2"}}, missing)
+}
+
+func TestMissingImages_WrongDigest(t *testing.T) {
+	expected, _ := ParseExpectedImages("repo/api@" + apiDigest)
+	deployed := []string{"repo/api@sha256:0000", "repo/api:1.4.2"}
+
+	missing := MissingImages(expected, deployed)
+
+	assert.Len(t, missing, 1)
+}
+
+func TestMissingImages_VersionTooLowOrNotSemver(t *testing.T) {
+	expected, _ := ParseExpectedImages("repo/api:>=1.4.0")
+	deployed := []string{"repo/api:1.3.9", "repo/api:latest"}
+
+	missing := MissingImages(expected, deployed)
+
+	assert.Len(t, missing, 1)
+}
+
+func TestMissingImages_NothingDeployed(t *testing.T) {
+	expected, _ := ParseExpectedImages("repo/api:1.4.2")
+
+	missing := MissingImages(expected, nil)
+
+	assert.Equal(t, expected, missing)
+}
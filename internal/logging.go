@@ -0,0 +1,78 @@
+package internal
+
+import (
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+const redacted = "[REDACTED]"
+
+// secretKeys are attribute keys of which the value is never logged.
+var secretKeys = []string{"token", "password", "authorization"}
+
+// Redactor removes secrets from log lines, both from attributes with a secret key and from any logged text.
+// Secrets that only become known at runtime, like a token from LOGIN mode, can be added while logging.
+type Redactor struct {
+	mu      sync.RWMutex
+	secrets []string
+}
+
+func NewRedactor(secrets ...string) *Redactor {
+	redactor := &Redactor{}
+	for _, secret := range secrets {
+		redactor.Add(secret)
+	}
+	return redactor
+}
+
+// Add registers a secret value that must not be logged.
+func (r *Redactor) Add(secret string) {
+	if secret == "" {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.secrets = append(r.secrets, secret)
+}
+
+// Redact replaces all known secret values in the text.
+func (r *Redactor) Redact(text string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, secret := range r.secrets {
+		text = strings.ReplaceAll(text, secret, redacted)
+	}
+	return text
+}
+
+// ReplaceAttr redacts a log attribute, it is meant to be used in slog.HandlerOptions.
+func (r *Redactor) ReplaceAttr(_ []string, attr slog.Attr) slog.Attr {
+	for _, key := range secretKeys {
+		if strings.Contains(strings.ToLower(attr.Key), key) {
+			return slog.String(attr.Key, redacted)
+		}
+	}
+	switch attr.Value.Kind() {
+	case slog.KindString:
+		return slog.String(attr.Key, r.Redact(attr.Value.String()))
+	case slog.KindAny:
+		if err, ok := attr.Value.Any().(error); ok {
+			return slog.String(attr.Key, r.Redact(err.Error()))
+		}
+	}
+	return attr
+}
+
+// NewLogger creates a logger that writes lines in the given format, leaving out lines below the given level.
+func NewLogger(w io.Writer, format LogFormat, level slog.Level, redactor *Redactor) *slog.Logger {
+	options := &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: redactor.ReplaceAttr,
+	}
+	if format == JsonLog {
+		return slog.New(slog.NewJSONHandler(w, options))
+	}
+	return slog.New(slog.NewTextHandler(w, options))
+}
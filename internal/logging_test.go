@@ -0,0 +1,50 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"log/slog"
+	"testing"
+)
+
+// testLogger discards all log lines of the components under test.
+var testLogger = slog.New(slog.DiscardHandler)
+
+func TestNewLogger_RedactsSecrets(t *testing.T) {
+	var output bytes.Buffer
+	redactor := NewRedactor("s3cr3t-password")
+	logger := NewLogger(&output, JsonLog, slog.LevelInfo, redactor)
+	redactor.Add("runtime-token")
+
+	logger.Info("Logging in with s3cr3t-password",
+		"app", "api",
+		"password", "anything",
+		"authToken", "anything",
+		"error", fmt.Errorf("token runtime-token expired"),
+	)
+
+	assert.NotContains(t, output.String(), "s3cr3t-password")
+	assert.NotContains(t, output.String(), "runtime-token")
+	assert.NotContains(t, output.String(), "anything")
+	assert.Contains(t, output.String(), `"msg":"Logging in with [REDACTED]"`)
+	assert.Contains(t, output.String(), `"app":"api"`)
+	assert.Contains(t, output.String(), `"error":"token [REDACTED] expired"`)
+}
+
+func TestNewLogger_Level(t *testing.T) {
+	var output bytes.Buffer
+	logger := NewLogger(&output, TextLog, slog.LevelWarn, NewRedactor())
+
+	logger.Info("hidden")
+	logger.Warn("shown", "attempt", 3)
+
+	assert.NotContains(t, output.String(), "hidden")
+	assert.Contains(t, output.String(), "level=WARN msg=shown attempt=3")
+}
+
+func TestRedactor_IgnoresEmptySecret(t *testing.T) {
+	redactor := NewRedactor("")
+
+	assert.Equal(t, "nothing to hide", redactor.Redact("nothing to hide"))
+}
@@ -0,0 +1,170 @@
+package internal
+
+import (
+	"context"
+	"github.com/argoproj/argo-cd/v2/pkg/apiclient/application"
+	"github.com/argoproj/argo-cd/v2/pkg/apiclient/applicationset"
+	"github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	repoapiclient "github.com/argoproj/argo-cd/v2/reposerver/apiclient"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io"
+	"log/slog"
+	"sync"
+)
+
+// TokenSource returns the API token to continue with after ArgoCD rejected the current token.
+type TokenSource func(ctx context.Context) (string, error)
+
+// AppClientFactory creates an ArgoCD application client that authenticates with the given token, and the closer of its connection.
+type AppClientFactory func(token string) (io.Closer, application.ApplicationServiceClient, error)
+
+// AppSetClientFactory creates an ArgoCD ApplicationSet client that authenticates with the given token, and the closer of its connection.
+type AppSetClientFactory func(token string) (io.Closer, applicationset.ApplicationSetServiceClient, error)
+
+// ReloadingAppClient gets a new token when ArgoCD rejects the token, and retries the request with the new token.
+// This keeps long verifications and servers running while the token is rotated in a file, or while the session of LOGIN mode expires.
+// Only the requests that KPCEA performs are retried, all other requests use the initial client, which is closed after a reload.
+type ReloadingAppClient struct {
+	application.ApplicationServiceClient
+	reloader *tokenReloader[application.ApplicationServiceClient]
+}
+
+func NewReloadingAppClient(client application.ApplicationServiceClient, closer io.Closer, token string, tokenSource TokenSource, newClient AppClientFactory, logger *slog.Logger) *ReloadingAppClient {
+	return &ReloadingAppClient{
+		ApplicationServiceClient: client,
+		reloader:                 newTokenReloader(client, closer, token, tokenSource, newClient, logger),
+	}
+}
+
+func (c *ReloadingAppClient) Get(ctx context.Context, in *application.ApplicationQuery, opts ...grpc.CallOption) (*v1alpha1.Application, error) {
+	return withReload(ctx, c.reloader, func(client application.ApplicationServiceClient) (*v1alpha1.Application, error) {
+		return client.Get(ctx, in, opts...)
+	})
+}
+
+func (c *ReloadingAppClient) List(ctx context.Context, in *application.ApplicationQuery, opts ...grpc.CallOption) (*v1alpha1.ApplicationList, error) {
+	return withReload(ctx, c.reloader, func(client application.ApplicationServiceClient) (*v1alpha1.ApplicationList, error) {
+		return client.List(ctx, in, opts...)
+	})
+}
+
+func (c *ReloadingAppClient) Watch(ctx context.Context, in *application.ApplicationQuery, opts ...grpc.CallOption) (application.ApplicationService_WatchClient, error) {
+	return withReload(ctx, c.reloader, func(client application.ApplicationServiceClient) (application.ApplicationService_WatchClient, error) {
+		return client.Watch(ctx, in, opts...)
+	})
+}
+
+func (c *ReloadingAppClient) Sync(ctx context.Context, in *application.ApplicationSyncRequest, opts ...grpc.CallOption) (*v1alpha1.Application, error) {
+	return withReload(ctx, c.reloader, func(client application.ApplicationServiceClient) (*v1alpha1.Application, error) {
+		return client.Sync(ctx, in, opts...)
+	})
+}
+
+func (c *ReloadingAppClient) RevisionMetadata(ctx context.Context, in *application.RevisionMetadataQuery, opts ...grpc.CallOption) (*v1alpha1.RevisionMetadata, error) {
+	return withReload(ctx, c.reloader, func(client application.ApplicationServiceClient) (*v1alpha1.RevisionMetadata, error) {
+		return client.RevisionMetadata(ctx, in, opts...)
+	})
+}
+
+func (c *ReloadingAppClient) GetManifests(ctx context.Context, in *application.ApplicationManifestQuery, opts ...grpc.CallOption) (*repoapiclient.ManifestResponse, error) {
+	return withReload(ctx, c.reloader, func(client application.ApplicationServiceClient) (*repoapiclient.ManifestResponse, error) {
+		return client.GetManifests(ctx, in, opts...)
+	})
+}
+
+// ReloadingAppSetClient is the ReloadingAppClient for ApplicationSets, it retries getting an ApplicationSet with the new token.
+type ReloadingAppSetClient struct {
+	applicationset.ApplicationSetServiceClient
+	reloader *tokenReloader[applicationset.ApplicationSetServiceClient]
+}
+
+func NewReloadingAppSetClient(client applicationset.ApplicationSetServiceClient, closer io.Closer, token string, tokenSource TokenSource, newClient AppSetClientFactory, logger *slog.Logger) *ReloadingAppSetClient {
+	return &ReloadingAppSetClient{
+		ApplicationSetServiceClient: client,
+		reloader:                    newTokenReloader(client, closer, token, tokenSource, newClient, logger),
+	}
+}
+
+func (c *ReloadingAppSetClient) Get(ctx context.Context, in *applicationset.ApplicationSetGetQuery, opts ...grpc.CallOption) (*v1alpha1.ApplicationSet, error) {
+	return withReload(ctx, c.reloader, func(client applicationset.ApplicationSetServiceClient) (*v1alpha1.ApplicationSet, error) {
+		return client.Get(ctx, in, opts...)
+	})
+}
+
+// tokenReloader holds the client for the current token, and replaces it when the token source returns a new token.
+type tokenReloader[C comparable] struct {
+	tokenSource TokenSource
+	newClient   func(token string) (io.Closer, C, error)
+	logger      *slog.Logger
+	mu          sync.RWMutex
+	token       string
+	current     C
+	closer      io.Closer
+}
+
+func newTokenReloader[C comparable](client C, closer io.Closer, token string, tokenSource TokenSource, newClient func(token string) (io.Closer, C, error), logger *slog.Logger) *tokenReloader[C] {
+	return &tokenReloader[C]{
+		tokenSource: tokenSource,
+		newClient:   newClient,
+		logger:      logger,
+		token:       token,
+		current:     client,
+		closer:      closer,
+	}
+}
+
+// withReload performs the request, and performs it once more with a new client when the token source returns a new token.
+func withReload[C comparable, T any](ctx context.Context, r *tokenReloader[C], request func(client C) (T, error)) (T, error) {
+	r.mu.RLock()
+	client := r.current
+	r.mu.RUnlock()
+
+	response, err := request(client)
+	if status.Code(err) != codes.Unauthenticated {
+		return response, err
+	}
+	reloaded, ok, reloadErr := r.reload(ctx, client)
+	if reloadErr != nil {
+		r.logger.Warn("Unable to reload API token", "error", reloadErr)
+		return response, err
+	}
+	if !ok {
+		return response, err
+	}
+	return request(reloaded)
+}
+
+// reload creates a new client when the token source returns a new token, and closes the connection of the rejected client.
+// It reports false when the token did not change, unless another request already reloaded the failed client.
+func (r *tokenReloader[C]) reload(ctx context.Context, failed C) (C, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var none C
+	if r.current != failed {
+		return r.current, true, nil
+	}
+	token, err := r.tokenSource(ctx)
+	if err != nil {
+		return none, false, err
+	}
+	if token == r.token {
+		return none, false, nil
+	}
+	closer, client, err := r.newClient(token)
+	if err != nil {
+		return none, false, err
+	}
+	r.logger.Info("API token was rejected by ArgoCD, continuing with a new token")
+	if r.closer != nil {
+		// Requests that still use the rejected client fail, and are retried by the verification
+		if closeErr := r.closer.Close(); closeErr != nil {
+			r.logger.Warn("Unable to close the connection of the rejected client", "error", closeErr)
+		}
+	}
+	r.token = token
+	r.current = client
+	r.closer = closer
+	return client, true, nil
+}
@@ -0,0 +1,174 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"github.com/argoproj/argo-cd/v2/pkg/apiclient/application"
+	"github.com/argoproj/argo-cd/v2/pkg/apiclient/applicationset"
+	"github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io"
+	"path/filepath"
+	"testing"
+)
+
+// MockTokenAppClient only accepts requests that are made with the valid token.
+type MockTokenAppClient struct {
+	application.ApplicationServiceClient
+	token      string
+	validToken string
+}
+
+func (m *MockTokenAppClient) Get(_ context.Context, in *application.ApplicationQuery, _ ...grpc.CallOption) (*v1alpha1.Application, error) {
+	if m.token != m.validToken {
+		return nil, status.Error(codes.Unauthenticated, "invalid session: token has expired")
+	}
+	app := &v1alpha1.Application{}
+	app.Name = in.GetName()
+	return app, nil
+}
+
+// MockTokenAppSetClient only accepts requests that are made with the valid token.
+type MockTokenAppSetClient struct {
+	applicationset.ApplicationSetServiceClient
+	token      string
+	validToken string
+}
+
+func (m *MockTokenAppSetClient) Get(_ context.Context, in *applicationset.ApplicationSetGetQuery, _ ...grpc.CallOption) (*v1alpha1.ApplicationSet, error) {
+	if m.token != m.validToken {
+		return nil, status.Error(codes.Unauthenticated, "invalid session: token has expired")
+	}
+	appSet := &v1alpha1.ApplicationSet{}
+	appSet.Name = in.GetName()
+	return appSet, nil
+}
+
+// MockCloser counts how often the connection of a client is closed.
+type MockCloser struct {
+	closed int
+}
+
+func (m *MockCloser) Close() error {
+	m.closed++
+	return nil
+}
+
+func newTokenClientFactory(validToken string, created *int) AppClientFactory {
+	return func(token string) (io.Closer, application.ApplicationServiceClient, error) {
+		*created++
+		return &MockCloser{}, &MockTokenAppClient{token: token, validToken: validToken}, nil
+	}
+}
+
+func TestReloadingAppClient_ReloadsRotatedToken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	writeTokenFile(t, path, "new-token")
+	created := 0
+	initial := &MockTokenAppClient{token: "old-token", validToken: "new-token"}
+	client := NewReloadingAppClient(initial, nil, "old-token", FileTokenSource(path), newTokenClientFactory("new-token", &created), testLogger)
+	name := "my-app"
+
+	first, firstErr := client.Get(context.Background(), &application.ApplicationQuery{Name: &name})
+	second, secondErr := client.Get(context.Background(), &application.ApplicationQuery{Name: &name})
+
+	assert.NoError(t, firstErr)
+	assert.Equal(t, "my-app", first.Name)
+	assert.NoError(t, secondErr)
+	assert.Equal(t, "my-app", second.Name)
+	assert.Equal(t, 1, created)
+}
+
+func TestReloadingAppClient_TokenNotRotated(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	writeTokenFile(t, path, "old-token")
+	created := 0
+	initial := &MockTokenAppClient{token: "old-token", validToken: "new-token"}
+	client := NewReloadingAppClient(initial, nil, "old-token", FileTokenSource(path), newTokenClientFactory("new-token", &created), testLogger)
+
+	_, err := client.Get(context.Background(), &application.ApplicationQuery{})
+
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	assert.Equal(t, 0, created)
+}
+
+func TestReloadingAppClient_TokenFileMissing(t *testing.T) {
+	created := 0
+	initial := &MockTokenAppClient{token: "old-token", validToken: "new-token"}
+	client := NewReloadingAppClient(initial, nil, "old-token", FileTokenSource(filepath.Join(t.TempDir(), "missing")), newTokenClientFactory("new-token", &created), testLogger)
+
+	_, err := client.Get(context.Background(), &application.ApplicationQuery{})
+
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	assert.Equal(t, 0, created)
+}
+
+func TestReloadingAppClient_ClosesRejectedClient(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	writeTokenFile(t, path, "new-token")
+	created := 0
+	initial := &MockTokenAppClient{token: "old-token", validToken: "new-token"}
+	initialCloser := &MockCloser{}
+	client := NewReloadingAppClient(initial, initialCloser, "old-token", FileTokenSource(path), newTokenClientFactory("new-token", &created), testLogger)
+
+	_, err := client.Get(context.Background(), &application.ApplicationQuery{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, created)
+	assert.Equal(t, 1, initialCloser.closed)
+}
+
+func TestReloadingAppSetClient_ReloadsRotatedToken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	writeTokenFile(t, path, "new-token")
+	initialCloser := &MockCloser{}
+	initial := &MockTokenAppSetClient{token: "old-token", validToken: "new-token"}
+	client := NewReloadingAppSetClient(initial, initialCloser, "old-token", FileTokenSource(path), func(token string) (io.Closer, applicationset.ApplicationSetServiceClient, error) {
+		return &MockCloser{}, &MockTokenAppSetClient{token: token, validToken: "new-token"}, nil
+	}, testLogger)
+
+	appSet, err := client.Get(context.Background(), &applicationset.ApplicationSetGetQuery{Name: "my-appset"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "my-appset", appSet.Name)
+	assert.Equal(t, 1, initialCloser.closed)
+}
+
+func TestReloadingAppClient_LogsInAgain(t *testing.T) {
+	created := 0
+	logins := 0
+	initial := &MockTokenAppClient{token: "expired-session", validToken: "new-session"}
+	login := func(_ context.Context) (string, error) {
+		logins++
+		return "new-session", nil
+	}
+	client := NewReloadingAppClient(initial, nil, "expired-session", login, newTokenClientFactory("new-session", &created), testLogger)
+	name := "my-app"
+
+	first, firstErr := client.Get(context.Background(), &application.ApplicationQuery{Name: &name})
+	second, secondErr := client.Get(context.Background(), &application.ApplicationQuery{Name: &name})
+
+	assert.NoError(t, firstErr)
+	assert.Equal(t, "my-app", first.Name)
+	assert.NoError(t, secondErr)
+	assert.Equal(t, "my-app", second.Name)
+	assert.Equal(t, 1, logins)
+	assert.Equal(t, 1, created)
+}
+
+func TestReloadingAppClient_LoginFails(t *testing.T) {
+	created := 0
+	initial := &MockTokenAppClient{token: "expired-session", validToken: "new-session"}
+	login := func(_ context.Context) (string, error) {
+		return "", errors.New("token request not accepted by ArgoCD (http 401)")
+	}
+	client := NewReloadingAppClient(initial, nil, "expired-session", login, newTokenClientFactory("new-session", &created), testLogger)
+
+	_, err := client.Get(context.Background(), &application.ApplicationQuery{})
+
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	assert.Equal(t, 0, created)
+}
@@ -0,0 +1,37 @@
+package internal
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// AppResult describes the outcome of verifying a single Argo app.
+type AppResult struct {
+	App              string  `json:"app"`
+	ExpectedRevision string  `json:"expectedRevision,omitempty"`
+	ObservedRevision string  `json:"observedRevision,omitempty"`
+	SyncStatus       string  `json:"syncStatus,omitempty"`
+	HealthStatus     string  `json:"healthStatus,omitempty"`
+	CommitMessage    string  `json:"commitMessage,omitempty"`
+	Attempts         int     `json:"attempts"`
+	ElapsedSeconds   float64 `json:"elapsedSeconds"`
+	FailureReason    string  `json:"failureReason,omitempty"`
+	ExitCode         int     `json:"exitCode"`
+}
+
+// Report is the final result of a KPCEA run, for Kargo and CI to read.
+type Report struct {
+	InExpectedState bool        `json:"inExpectedState"`
+	ExitCode        int         `json:"exitCode"`
+	ElapsedSeconds  float64     `json:"elapsedSeconds"`
+	FailureReason   string      `json:"failureReason,omitempty"`
+	Apps            []AppResult `json:"apps"`
+}
+
+// WriteJSON writes the report as a single line of JSON.
+func (r *Report) WriteJSON(w io.Writer) error {
+	if r.Apps == nil {
+		r.Apps = []AppResult{}
+	}
+	return json.NewEncoder(w).Encode(r)
+}
@@ -0,0 +1,41 @@
+package internal
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestReport_WriteJSON(t *testing.T) {
+	report := &Report{
+		ExitCode:       2,
+		ElapsedSeconds: 12.5,
+		Apps: []AppResult{{
+			App:              "team-payments/api",
+			ExpectedRevision: "abc123",
+			ObservedRevision: "def456",
+			SyncStatus:       "Synced",
+			HealthStatus:     "Degraded",
+			Attempts:         3,
+			ElapsedSeconds:   12.5,
+			FailureReason:    "app health is Degraded",
+			ExitCode:         2,
+		}},
+	}
+	var output bytes.Buffer
+
+	err := report.WriteJSON(&output)
+
+	assert.NoError(t, err)
+	assert.Equal(t, `{"inExpectedState":false,"exitCode":2,"elapsedSeconds":12.5,"apps":[{"app":"team-payments/api","expectedRevision":"abc123","observedRevision":"def456","syncStatus":"Synced","healthStatus":"Degraded","attempts":3,"elapsedSeconds":12.5,"failureReason":"app health is Degraded","exitCode":2}]}`+"\n", output.String())
+}
+
+func TestReport_WriteJSON_WithoutApps(t *testing.T) {
+	report := &Report{ExitCode: 1, FailureReason: "no apps to verify"}
+	var output bytes.Buffer
+
+	err := report.WriteJSON(&output)
+
+	assert.NoError(t, err)
+	assert.Equal(t, `{"inExpectedState":false,"exitCode":1,"elapsedSeconds":0,"failureReason":"no apps to verify","apps":[]}`+"\n", output.String())
+}
@@ -0,0 +1,91 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"github.com/argoproj/argo-cd/v2/pkg/apiclient/application"
+	"github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	repoapiclient "github.com/argoproj/argo-cd/v2/reposerver/apiclient"
+	"google.golang.org/grpc"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const minShortSHALength = 7
+
+var commitSHAPattern = regexp.MustCompile(`^[0-9a-fA-F]{7,40}$`)
+
+// IsCommitSHA reports whether the revision looks like a full or abbreviated git commit SHA.
+func IsCommitSHA(revision string) bool {
+	return commitSHAPattern.MatchString(revision)
+}
+
+// RevisionMatches compares an expected revision with the revision reported by ArgoCD.
+// An abbreviated commit SHA matches any full SHA that starts with it.
+func RevisionMatches(expected string, found string) bool {
+	if expected == found {
+		return true
+	}
+	if len(expected) < minShortSHALength || !IsCommitSHA(expected) || !IsCommitSHA(found) {
+		return false
+	}
+	return strings.HasPrefix(strings.ToLower(found), strings.ToLower(expected))
+}
+
+type ApplicationRevisionClient interface {
+	RevisionMetadata(ctx context.Context, in *application.RevisionMetadataQuery, opts ...grpc.CallOption) (*v1alpha1.RevisionMetadata, error)
+	GetManifests(ctx context.Context, in *application.ApplicationManifestQuery, opts ...grpc.CallOption) (*repoapiclient.ManifestResponse, error)
+}
+
+// RevisionResolver checks whether a symbolic revision (tag or branch) points to the synced commit of an Argo app.
+// The answer is kept per synced commit, so ArgoCD only resolves the symbolic revision again when the app syncs another commit.
+type RevisionResolver struct {
+	client   ApplicationRevisionClient
+	app      AppRef
+	resolved map[string]bool
+}
+
+func NewRevisionResolver(client ApplicationRevisionClient, app AppRef) *RevisionResolver {
+	return &RevisionResolver{
+		client:   client,
+		app:      app,
+		resolved: map[string]bool{},
+	}
+}
+
+// PointsTo first looks for the symbolic revision in the tags of the synced commit.
+// When it is not found there, ArgoCD is asked to resolve the symbolic revision through the repository of the app.
+func (r *RevisionResolver) PointsTo(ctx context.Context, symbolic string, synced string) (bool, error) {
+	key := symbolic + "@" + synced
+	if pointsTo, found := r.resolved[key]; found {
+		return pointsTo, nil
+	}
+	pointsTo, err := r.pointsTo(ctx, symbolic, synced)
+	if err != nil {
+		return false, err
+	}
+	r.resolved[key] = pointsTo
+	return pointsTo, nil
+}
+
+func (r *RevisionResolver) pointsTo(ctx context.Context, symbolic string, synced string) (bool, error) {
+	revisionMetadata, err := r.client.RevisionMetadata(ctx, r.app.RevisionMetadataQuery(synced))
+	if err != nil {
+		return false, fmt.Errorf("unable to get revision metadata for %s: %v", synced, err)
+	}
+	if slices.Contains(revisionMetadata.Tags, symbolic) {
+		return true, nil
+	}
+
+	manifests, err := r.client.GetManifests(ctx, &application.ApplicationManifestQuery{
+		Name:         &r.app.Name,
+		AppNamespace: r.app.namespace(),
+		Project:      r.app.project(),
+		Revision:     &symbolic,
+	})
+	if err != nil {
+		return false, fmt.Errorf("unable to resolve revision %s: %v", symbolic, err)
+	}
+	return RevisionMatches(manifests.Revision, synced), nil
+}
@@ -0,0 +1,167 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"github.com/argoproj/argo-cd/v2/pkg/apiclient/application"
+	"github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	repoapiclient "github.com/argoproj/argo-cd/v2/reposerver/apiclient"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"testing"
+)
+
+const syncedSHA = "3f2a9c1d8e7b6a5f4e3d2c1b0a9f8e7d6c5b4a39"
+
+type MockRevisionClient struct {
+	Metadata      *v1alpha1.RevisionMetadata
+	MetadataErr   error
+	MetadataCalls int
+	Manifests     *repoapiclient.ManifestResponse
+	ManifestErr   error
+	Resolved      []string
+}
+
+func (m *MockRevisionClient) RevisionMetadata(_ context.Context, _ *application.RevisionMetadataQuery, _ ...grpc.CallOption) (*v1alpha1.RevisionMetadata, error) {
+	m.MetadataCalls++
+	return m.Metadata, m.MetadataErr
+}
+
+func (m *MockRevisionClient) GetManifests(_ context.Context, in *application.ApplicationManifestQuery, _ ...grpc.CallOption) (*repoapiclient.ManifestResponse, error) {
+	m.Resolved = append(m.Resolved, in.GetRevision())
+	return m.Manifests, m.ManifestErr
+}
+
+func TestRevisionMatches(t *testing.T) {
+	tests := []struct {
+		expected string
+		found    string
+		match    bool
+	}{
+		{syncedSHA, syncedSHA, true},
+		{"3f2a9c1", syncedSHA, true},
+		{"3f2a9c1d", syncedSHA, true},
+		{"3F2A9C1D", syncedSHA, true},
+		{"3f2a9c", syncedSHA, false},
+		{"4f2a9c1", syncedSHA, false},
+		{"v1.8.0", "v1.8.0", true},
+		{"v1.8.0", syncedSHA, false},
+		{"3f2a9c1", "3f2a9c1-dirty", false},
+		{"1.4.2", "1.4.2", true},
+	}
+	for _, test := range tests {
+		t.Run(test.expected+"/"+test.found, func(t *testing.T) {
+			assert.Equal(t, test.match, RevisionMatches(test.expected, test.found))
+		})
+	}
+}
+
+func TestIsCommitSHA(t *testing.T) {
+	assert.True(t, IsCommitSHA(syncedSHA))
+	assert.True(t, IsCommitSHA("3f2a9c1"))
+	assert.False(t, IsCommitSHA("3f2a9c"))
+	assert.False(t, IsCommitSHA("v1.8.0"))
+	assert.False(t, IsCommitSHA("main"))
+}
+
+func TestRevisionResolver_PointsTo_TagOnSyncedCommit(t *testing.T) {
+	mockClient := &MockRevisionClient{Metadata: &v1alpha1.RevisionMetadata{Tags: []string{"v1.7.9", "v1.8.0"}}}
+	resolver := NewRevisionResolver(mockClient, AppRef{Name: "my-app"})
+
+	pointsTo, err := resolver.PointsTo(context.Background(), "v1.8.0", syncedSHA)
+
+	assert.NoError(t, err)
+	assert.True(t, pointsTo)
+	assert.Empty(t, mockClient.Resolved)
+}
+
+func TestRevisionResolver_PointsTo_ResolvedThroughRepository(t *testing.T) {
+	mockClient := &MockRevisionClient{
+		Metadata:  &v1alpha1.RevisionMetadata{},
+		Manifests: &repoapiclient.ManifestResponse{Revision: syncedSHA},
+	}
+	resolver := NewRevisionResolver(mockClient, AppRef{Name: "my-app"})
+
+	pointsTo, err := resolver.PointsTo(context.Background(), "main", syncedSHA)
+
+	assert.NoError(t, err)
+	assert.True(t, pointsTo)
+	assert.Equal(t, []string{"main"}, mockClient.Resolved)
+}
+
+func TestRevisionResolver_PointsTo_ResolvedToOtherCommit(t *testing.T) {
+	mockClient := &MockRevisionClient{
+		Metadata:  &v1alpha1.RevisionMetadata{Tags: []string{"v1.7.9"}},
+		Manifests: &repoapiclient.ManifestResponse{Revision: "0000000000000000000000000000000000000000"},
+	}
+	resolver := NewRevisionResolver(mockClient, AppRef{Name: "my-app"})
+
+	pointsTo, err := resolver.PointsTo(context.Background(), "v1.8.0", syncedSHA)
+
+	assert.NoError(t, err)
+	assert.False(t, pointsTo)
+}
+
+func TestRevisionResolver_PointsTo_MetadataError(t *testing.T) {
+	mockClient := &MockRevisionClient{MetadataErr: fmt.Errorf("testError")}
+	resolver := NewRevisionResolver(mockClient, AppRef{Name: "my-app"})
+
+	pointsTo, err := resolver.PointsTo(context.Background(), "v1.8.0", syncedSHA)
+
+	assert.Error(t, err)
+	assert.False(t, pointsTo)
+	assert.Equal(t, "unable to get revision metadata for "+syncedSHA+": testError", err.Error())
+}
+
+func TestRevisionResolver_PointsTo_ManifestError(t *testing.T) {
+	mockClient := &MockRevisionClient{
+		Metadata:    &v1alpha1.RevisionMetadata{},
+		ManifestErr: fmt.Errorf("testError"),
+	}
+	resolver := NewRevisionResolver(mockClient, AppRef{Name: "my-app"})
+
+	pointsTo, err := resolver.PointsTo(context.Background(), "v1.8.0", syncedSHA)
+
+	assert.Error(t, err)
+	assert.False(t, pointsTo)
+	assert.Equal(t, "unable to resolve revision v1.8.0: testError", err.Error())
+}
+
+func TestRevisionResolver_PointsTo_ResolvesOncePerSyncedCommit(t *testing.T) {
+	mockClient := &MockRevisionClient{
+		Metadata:  &v1alpha1.RevisionMetadata{},
+		Manifests: &repoapiclient.ManifestResponse{Revision: syncedSHA},
+	}
+	resolver := NewRevisionResolver(mockClient, AppRef{Name: "my-app"})
+	otherSHA := "9b8c7d6e5f4a3b2c1d0e9f8a7b6c5d4e3f2a1b0c"
+
+	for range 3 {
+		pointsTo, err := resolver.PointsTo(context.Background(), "main", otherSHA)
+		assert.NoError(t, err)
+		assert.False(t, pointsTo)
+	}
+	pointsTo, err := resolver.PointsTo(context.Background(), "main", syncedSHA)
+
+	assert.NoError(t, err)
+	assert.True(t, pointsTo)
+	assert.Equal(t, 2, mockClient.MetadataCalls)
+	assert.Equal(t, []string{"main", "main"}, mockClient.Resolved)
+}
+
+func TestRevisionResolver_PointsTo_ErrorIsNotCached(t *testing.T) {
+	mockClient := &MockRevisionClient{
+		Metadata:    &v1alpha1.RevisionMetadata{},
+		ManifestErr: fmt.Errorf("testError"),
+	}
+	resolver := NewRevisionResolver(mockClient, AppRef{Name: "my-app"})
+
+	_, err := resolver.PointsTo(context.Background(), "main", syncedSHA)
+	assert.Error(t, err)
+	mockClient.ManifestErr = nil
+	mockClient.Manifests = &repoapiclient.ManifestResponse{Revision: syncedSHA}
+	pointsTo, err := resolver.PointsTo(context.Background(), "main", syncedSHA)
+
+	assert.NoError(t, err)
+	assert.True(t, pointsTo)
+	assert.Len(t, mockClient.Resolved, 2)
+}
@@ -0,0 +1,110 @@
+package internal
+
+import (
+	"fmt"
+	"github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	"strings"
+)
+
+// SourceRevision is the expected revision of one source of a multi-source Argo app.
+// The source is identified by RepoURL, or by its Index in spec.sources when no RepoURL is given.
+type SourceRevision struct {
+	RepoURL  string
+	Index    int
+	Revision string
+}
+
+func (s SourceRevision) source() string {
+	if s.RepoURL != "" {
+		return s.RepoURL
+	}
+	return fmt.Sprintf("#%d", s.Index)
+}
+
+// String formats the source revision like an entry of KPCEA_TARGET_REVISIONS.
+func (s SourceRevision) String() string {
+	if s.RepoURL != "" {
+		return s.RepoURL + "=" + s.Revision
+	}
+	return s.Revision
+}
+
+// RevisionMismatch describes a source that is not synced to its expected revision.
+type RevisionMismatch struct {
+	Source   string
+	Expected string
+	Found    string
+}
+
+func (m RevisionMismatch) String() string {
+	if m.Found == "" {
+		return fmt.Sprintf("source %s expected %s but found no synced revision", m.Source, m.Expected)
+	}
+	return fmt.Sprintf("source %s expected %s but found %s", m.Source, m.Expected, m.Found)
+}
+
+// ParseTargetRevisions parses a semicolon-separated list of expected source revisions.
+// Each entry is either "repoURL=revision", or a bare "revision" that is matched by its position in the list.
+func ParseTargetRevisions(value string) ([]SourceRevision, error) {
+	var revisions []SourceRevision
+	for index, entry := range strings.Split(value, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			return nil, fmt.Errorf("entry #%d is empty", index)
+		}
+		revision := SourceRevision{Index: index, Revision: entry}
+		if i := strings.LastIndex(entry, "="); i >= 0 {
+			revision.RepoURL = strings.TrimSpace(entry[:i])
+			revision.Revision = strings.TrimSpace(entry[i+1:])
+		}
+		if revision.Revision == "" {
+			return nil, fmt.Errorf("entry '%s' has no revision", entry)
+		}
+		revisions = append(revisions, revision)
+	}
+	return revisions, nil
+}
+
+// MismatchedSourceRevisions compares the synced revision of each source against the expected revisions.
+// Single-source apps are treated as an app with one source at index 0.
+func MismatchedSourceRevisions(expected []SourceRevision, app *v1alpha1.Application) []RevisionMismatch {
+	sources := app.Spec.GetSources()
+	syncedRevisions := app.Status.Sync.Revisions
+	if !app.Spec.HasMultipleSources() {
+		syncedRevisions = []string{app.Status.Sync.Revision}
+	}
+
+	var mismatches []RevisionMismatch
+	for _, revision := range expected {
+		index := findSourceIndex(revision, sources)
+		if index < 0 || index >= len(syncedRevisions) {
+			mismatches = append(mismatches, RevisionMismatch{Source: revision.source(), Expected: revision.Revision})
+			continue
+		}
+		if !RevisionMatches(revision.Revision, syncedRevisions[index]) {
+			mismatches = append(mismatches, RevisionMismatch{
+				Source:   revision.source(),
+				Expected: revision.Revision,
+				Found:    syncedRevisions[index],
+			})
+		}
+	}
+	return mismatches
+}
+
+func findSourceIndex(revision SourceRevision, sources v1alpha1.ApplicationSources) int {
+	if revision.RepoURL == "" {
+		return revision.Index
+	}
+	for i, source := range sources {
+		if normalizeRepoURL(source.RepoURL) == normalizeRepoURL(revision.RepoURL) {
+			return i
+		}
+	}
+	return -1
+}
+
+func normalizeRepoURL(repoURL string) string {
+	repoURL = strings.TrimSuffix(strings.ToLower(repoURL), "/")
+	return strings.TrimSuffix(repoURL, ".git")
+}
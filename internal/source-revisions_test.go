@@ -0,0 +1,94 @@
+package internal
+
+import (
+	"github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func newMultiSourceApp(revisions ...string) *v1alpha1.Application {
+	return &v1alpha1.Application{
+		Spec: v1alpha1.ApplicationSpec{
+			Sources: v1alpha1.ApplicationSources{
+				{RepoURL: "https://github.com/org/charts", Chart: "api"},
+				{RepoURL: "https://github.com/org/values.git", Ref: "values"},
+			},
+		},
+		Status: v1alpha1.ApplicationStatus{
+			Sync: v1alpha1.SyncStatus{Revisions: revisions},
+		},
+	}
+}
+
+func TestParseTargetRevisions_ByRepoURLAndIndex(t *testing.T) {
+	revisions, err := ParseTargetRevisions("https://github.com/org/charts=v2.3.0; abc123")
+
+	assert.NoError(t, err)
+	assert.Equal(t, []SourceRevision{
+		{RepoURL: "https://github.com/org/charts", Index: 0, Revision: "v2.3.0"},
+		{Index: 1, Revision: "abc123"},
+	}, revisions)
+}
+
+func TestParseTargetRevisions_EmptyEntry(t *testing.T) {
+	_, err := ParseTargetRevisions("v2.3.0;;abc123")
+
+	assert.Error(t, err)
+	assert.Equal(t, "entry #1 is empty", err.Error())
+}
+
+func TestMismatchedSourceRevisions_AllSourcesMatchByRepoURL(t *testing.T) {
+	expected, _ := ParseTargetRevisions("https://github.com/org/values=abc123;https://github.com/org/charts/=v2.3.0")
+
+	mismatches := MismatchedSourceRevisions(expected, newMultiSourceApp("v2.3.0", "abc123"))
+
+	assert.Empty(t, mismatches)
+}
+
+func TestMismatchedSourceRevisions_AllSourcesMatchByIndex(t *testing.T) {
+	expected, _ := ParseTargetRevisions("v2.3.0;abc123")
+
+	mismatches := MismatchedSourceRevisions(expected, newMultiSourceApp("v2.3.0", "abc123"))
+
+	assert.Empty(t, mismatches)
+}
+
+func TestMismatchedSourceRevisions_OneSourceDiffers(t *testing.T) {
+	expected, _ := ParseTargetRevisions("https://github.com/org/charts=v2.3.0;https://github.com/org/values=abc123")
+
+	mismatches := MismatchedSourceRevisions(expected, newMultiSourceApp("v2.3.0", "def456"))
+
+	assert.Equal(t, []RevisionMismatch{
+		{Source: "https://github.com/org/values", Expected: "abc123", Found: "def456"},
+	}, mismatches)
+	assert.Equal(t, "source https://github.com/org/values expected abc123 but found def456", mismatches[0].String())
+}
+
+func TestMismatchedSourceRevisions_UnknownRepoURL(t *testing.T) {
+	expected, _ := ParseTargetRevisions("https://github.com/org/other=v1.0.0")
+
+	mismatches := MismatchedSourceRevisions(expected, newMultiSourceApp("v2.3.0", "abc123"))
+
+	assert.Len(t, mismatches, 1)
+	assert.Equal(t, "source https://github.com/org/other expected v1.0.0 but found no synced revision", mismatches[0].String())
+}
+
+func TestMismatchedSourceRevisions_IndexOutOfRange(t *testing.T) {
+	expected, _ := ParseTargetRevisions("v2.3.0;abc123;extra")
+
+	mismatches := MismatchedSourceRevisions(expected, newMultiSourceApp("v2.3.0", "abc123"))
+
+	assert.Equal(t, []RevisionMismatch{{Source: "#2", Expected: "extra"}}, mismatches)
+}
+
+func TestMismatchedSourceRevisions_SingleSourceApp(t *testing.T) {
+	app := &v1alpha1.Application{
+		Spec:   v1alpha1.ApplicationSpec{Source: &v1alpha1.ApplicationSource{RepoURL: "https://github.com/org/app"}},
+		Status: v1alpha1.ApplicationStatus{Sync: v1alpha1.SyncStatus{Revision: "abc123"}},
+	}
+	expected, _ := ParseTargetRevisions("https://github.com/org/app=abc123")
+
+	mismatches := MismatchedSourceRevisions(expected, app)
+
+	assert.Empty(t, mismatches)
+}
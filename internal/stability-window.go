@@ -0,0 +1,46 @@
+package internal
+
+import (
+	"log/slog"
+	"time"
+)
+
+// StabilityWindow requires the Argo app to stay in the expected state for a period of time before reporting success.
+// Apps can report Healthy for a few seconds during a rollout, before the new pods start crash-looping.
+type StabilityWindow struct {
+	duration time.Duration
+	since    time.Time
+	stable   bool
+	logger   *slog.Logger
+	now      Clock
+}
+
+func NewStabilityWindow(duration time.Duration, now Clock, logger *slog.Logger) *StabilityWindow {
+	return &StabilityWindow{
+		duration: duration,
+		logger:   logger,
+		now:      now,
+	}
+}
+
+// Observe records whether the app is currently in the expected state.
+// It returns true once the app has been in the expected state on every observation for the whole window.
+func (w *StabilityWindow) Observe(inExpectedState bool) bool {
+	if !inExpectedState {
+		if w.stable {
+			w.logger.Warn("App left the expected state, restarting stability window")
+		}
+		w.stable = false
+		return false
+	}
+	if !w.stable {
+		w.stable = true
+		w.since = w.now()
+	}
+	stableFor := w.now().Sub(w.since)
+	if stableFor < w.duration {
+		w.logger.Info("App is in expected state, waiting until it is stable", "stableFor", stableFor.Round(time.Second), "window", w.duration)
+		return false
+	}
+	return true
+}
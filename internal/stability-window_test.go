@@ -0,0 +1,48 @@
+package internal
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestStabilityWindow_Observe_WithoutDurationSucceedsImmediately(t *testing.T) {
+	window := NewStabilityWindow(0, time.Now, testLogger)
+
+	assert.False(t, window.Observe(false))
+	assert.True(t, window.Observe(true))
+}
+
+func TestStabilityWindow_Observe_WaitsForDuration(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	window := NewStabilityWindow(60*time.Second, func() time.Time { return now }, testLogger)
+
+	stableAtStart := window.Observe(true)
+	now = now.Add(59 * time.Second)
+	stableWithinWindow := window.Observe(true)
+	now = now.Add(time.Second)
+	stableAfterWindow := window.Observe(true)
+
+	assert.False(t, stableAtStart)
+	assert.False(t, stableWithinWindow)
+	assert.True(t, stableAfterWindow)
+}
+
+func TestStabilityWindow_Observe_FlappingRestartsWindow(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	window := NewStabilityWindow(60*time.Second, func() time.Time { return now }, testLogger)
+
+	_ = window.Observe(true)
+	now = now.Add(50 * time.Second)
+	degraded := window.Observe(false)
+	now = now.Add(5 * time.Second)
+	_ = window.Observe(true)
+	now = now.Add(55 * time.Second)
+	stableWithinNewWindow := window.Observe(true)
+	now = now.Add(5 * time.Second)
+	stableAfterNewWindow := window.Observe(true)
+
+	assert.False(t, degraded)
+	assert.False(t, stableWithinNewWindow)
+	assert.True(t, stableAfterNewWindow)
+}
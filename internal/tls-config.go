@@ -0,0 +1,38 @@
+package internal
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// NewTLSConfig creates the TLS configuration for requests to ArgoCD.
+// The CA bundle is trusted next to the system CAs, and the client certificate is presented for mTLS when it is configured.
+func NewTLSConfig(config *Config) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: config.TLSSkipVerify,
+	}
+	if config.CAFile != "" {
+		caBundle, err := os.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read CA file: %v", err)
+		}
+		rootCAs, err := x509.SystemCertPool()
+		if err != nil {
+			rootCAs = x509.NewCertPool()
+		}
+		if !rootCAs.AppendCertsFromPEM(caBundle) {
+			return nil, fmt.Errorf("CA file %s does not contain any PEM encoded certificates", config.CAFile)
+		}
+		tlsConfig.RootCAs = rootCAs
+	}
+	if config.ClientCertFile != "" {
+		clientCert, err := tls.LoadX509KeyPair(config.ClientCertFile, config.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{clientCert}
+	}
+	return tlsConfig, nil
+}
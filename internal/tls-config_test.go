@@ -0,0 +1,82 @@
+package internal
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCertificate writes a self-signed certificate and its key as PEM files, and returns their paths.
+func writeCertificate(t *testing.T, dir string) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "kpcea-test"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to encode key: %v", err)
+	}
+
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	_ = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	_ = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	return certFile, keyFile
+}
+
+func TestNewTLSConfig_Defaults(t *testing.T) {
+	tlsConfig, err := NewTLSConfig(&Config{})
+
+	assert.NoError(t, err)
+	assert.False(t, tlsConfig.InsecureSkipVerify)
+	assert.Nil(t, tlsConfig.RootCAs)
+	assert.Empty(t, tlsConfig.Certificates)
+}
+
+func TestNewTLSConfig_CAFileAndClientCertificate(t *testing.T) {
+	certFile, keyFile := writeCertificate(t, t.TempDir())
+
+	tlsConfig, err := NewTLSConfig(&Config{CAFile: certFile, ClientCertFile: certFile, ClientKeyFile: keyFile})
+
+	assert.NoError(t, err)
+	assert.NotNil(t, tlsConfig.RootCAs)
+	assert.Len(t, tlsConfig.Certificates, 1)
+}
+
+func TestNewTLSConfig_CAFileWithoutCertificates(t *testing.T) {
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	_ = os.WriteFile(caFile, []byte("not a certificate"), 0600)
+
+	_, err := NewTLSConfig(&Config{CAFile: caFile})
+
+	assert.EqualError(t, err, "CA file "+caFile+" does not contain any PEM encoded certificates")
+}
+
+func TestNewTLSConfig_MissingFiles(t *testing.T) {
+	_, caErr := NewTLSConfig(&Config{CAFile: "/does/not/exist"})
+	_, certErr := NewTLSConfig(&Config{ClientCertFile: "/does/not/exist", ClientKeyFile: "/does/not/exist"})
+
+	assert.EqualError(t, caErr, "unable to read CA file: open /does/not/exist: no such file or directory")
+	assert.EqualError(t, certErr, "unable to load client certificate: open /does/not/exist: no such file or directory")
+}
@@ -0,0 +1,28 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ReadTokenFile reads an API token from a file, like a projected Secret or a Vault Agent sink.
+func ReadTokenFile(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(content))
+	if token == "" {
+		return "", fmt.Errorf("file %s is empty", path)
+	}
+	return token, nil
+}
+
+// FileTokenSource reads the token from the file again every time a new token is needed.
+func FileTokenSource(path string) TokenSource {
+	return func(_ context.Context) (string, error) {
+		return ReadTokenFile(path)
+	}
+}
@@ -0,0 +1,45 @@
+package internal
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTokenFile(t *testing.T, path string, token string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(token+"\n"), 0600); err != nil {
+		t.Fatalf("failed to write token file: %v", err)
+	}
+}
+
+func TestReadTokenFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	writeTokenFile(t, path, "  api-token ")
+
+	token, err := ReadTokenFile(path)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "api-token", token)
+}
+
+func TestReadTokenFile_Empty(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	writeTokenFile(t, path, "")
+
+	_, err := ReadTokenFile(path)
+
+	assert.EqualError(t, err, "file "+path+" is empty")
+}
+
+func TestFileTokenSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	writeTokenFile(t, path, "api-token")
+
+	token, err := FileTokenSource(path)(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, "api-token", token)
+}
@@ -0,0 +1,352 @@
+package verifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/argoproj/argo-cd/v2/pkg/apiclient/application"
+	"github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	"google.golang.org/grpc"
+	"log/slog"
+	"rwslinkman/kargo-promotion-check-ext-argo/internal"
+	"strings"
+	"time"
+)
+
+// Client is the part of the ArgoCD application API that is needed to verify an app.
+// Waiting for changes with WATCH, triggering a sync and resolving revisions require a client that also implements
+// internal.ApplicationWatchClient, internal.ApplicationSyncClient and internal.ApplicationRevisionClient.
+type Client interface {
+	Get(ctx context.Context, in *application.ApplicationQuery, opts ...grpc.CallOption) (*v1alpha1.Application, error)
+	RevisionMetadata(ctx context.Context, in *application.RevisionMetadataQuery, opts ...grpc.CallOption) (*v1alpha1.RevisionMetadata, error)
+}
+
+type Status string
+
+const (
+	InExpectedState    Status = "IN_EXPECTED_STATE"
+	NotInExpectedState Status = "NOT_IN_EXPECTED_STATE"
+	TerminalFailure    Status = "TERMINAL_FAILURE"
+	Aborted            Status = "ABORTED"
+)
+
+// Result describes the last observed state of an app, and whether it reached the expected state.
+type Result struct {
+	Status           Status
+	ExpectedRevision string
+	ObservedRevision string
+	SyncStatus       string
+	HealthStatus     string
+	CommitMessage    string
+	Attempts         int
+	FailureReason    string
+}
+
+// Verifier waits for Argo apps to reach the state that is described by the configuration.
+type Verifier struct {
+	client Client
+	config *internal.Config
+	now    internal.Clock
+	logger *slog.Logger
+}
+
+func New(client Client, config *internal.Config, now internal.Clock, logger *slog.Logger) *Verifier {
+	return &Verifier{
+		client: client,
+		config: config,
+		now:    now,
+		logger: logger,
+	}
+}
+
+// Verify waits for a single Argo app to reach the expected state, until the timeout that started at start has passed.
+func (v *Verifier) Verify(ctx context.Context, app internal.AppRef, start time.Time) Result {
+	config := v.config
+	logger := v.logger.With("app", app.String())
+	result := Result{Status: NotInExpectedState, ExpectedRevision: expectedRevision(config)}
+
+	if config.TriggerSync {
+		if reason, failed := v.sync(ctx, app, start, logger); reason != "" {
+			result.FailureReason = reason
+			if failed {
+				result.Status = TerminalFailure
+			}
+			v.checkAborted(ctx, &result, logger)
+			return result
+		}
+	}
+
+	appQuery := app.Query()
+	var appSource internal.AppSource = internal.NewAppPoller(v.client, appQuery, config.PollInterval, config.Refresh, logger)
+	if config.WaitMode == internal.WatchWait {
+		watchClient, ok := v.client.(internal.ApplicationWatchClient)
+		if !ok {
+			result.Status = TerminalFailure
+			result.FailureReason = "client does not support watching apps"
+			return result
+		}
+		appSource = internal.NewAppWatcher(ctx, watchClient, appQuery, config.PollInterval, config.Refresh, logger)
+	}
+
+	failureDetector := internal.NewFailureDetector(config.FailureGracePeriod, v.now, logger)
+	stabilityWindow := internal.NewStabilityWindow(config.StableFor, v.now, logger)
+	var resolver *internal.RevisionResolver
+	if revisionClient, ok := v.client.(internal.ApplicationRevisionClient); ok {
+		// Shared by all attempts, so a symbolic revision is resolved once per synced commit instead of on every poll
+		resolver = internal.NewRevisionResolver(revisionClient, app)
+	}
+
+	for {
+		if v.now().Sub(start) > config.PollTimeout {
+			logger.Warn("Timeout reached while waiting for app to sync", "timeout", config.PollTimeout)
+			result.FailureReason = timeoutReason(config.PollTimeout, result.FailureReason)
+			break
+		}
+
+		// Wait for the next app state, but not beyond the timeout
+		nextCtx, cancelNext := context.WithTimeout(ctx, v.remaining(start))
+		argoApp, getErr := appSource.Next(nextCtx)
+		cancelNext()
+		if getErr != nil {
+			if v.checkAborted(ctx, &result, logger) {
+				break
+			}
+			if v.remaining(start) <= 0 {
+				// Timeout was reached while waiting, keep the reason of the last observed state
+				continue
+			}
+			logger.Warn("Failed to fetch app details, retrying", "error", getErr)
+			result.FailureReason = fmt.Sprintf("failed to fetch app details: %v", getErr)
+			continue
+		}
+		result.Attempts++
+		result.ObservedRevision = argoApp.Status.Sync.Revision
+		result.SyncStatus = string(argoApp.Status.Sync.Status)
+		result.HealthStatus = string(argoApp.Status.Health.Status)
+		logger := logger.With("attempt", result.Attempts)
+
+		logger.Info("Fetched app state",
+			"syncStatus", argoApp.Status.Sync.Status,
+			"revision", argoApp.Status.Sync.Revision,
+			"healthStatus", argoApp.Status.Health.Status,
+		)
+
+		if reason, failed := failureDetector.Check(argoApp, config.TargetRevision); failed {
+			logger.Error("App reached a terminal failure state", "reason", reason)
+			result.FailureReason = reason
+			result.Status = TerminalFailure
+			break
+		}
+
+		inExpectedState := false
+		if argoApp.Status.Sync.Status == "Synced" && argoApp.Status.Health.Status == "Healthy" {
+			var reason string
+			var failed bool
+			inExpectedState, reason, failed = v.check(ctx, app, argoApp, resolver, &result, logger)
+			if failed {
+				result.FailureReason = reason
+				result.Status = TerminalFailure
+				v.checkAborted(ctx, &result, logger)
+				break
+			}
+			result.FailureReason = reason
+		} else {
+			logger.Info("App is not in sync, retrying")
+			result.FailureReason = fmt.Sprintf("app is %s and %s", argoApp.Status.Sync.Status, argoApp.Status.Health.Status)
+		}
+
+		if stabilityWindow.Observe(inExpectedState) {
+			result.FailureReason = ""
+			result.Status = InExpectedState
+			break
+		}
+	}
+	return result
+}
+
+// sync triggers a sync of the app to the target revision, and follows the operation until it is finished.
+// It returns why the sync did not succeed, and whether that is a terminal failure.
+func (v *Verifier) sync(ctx context.Context, app internal.AppRef, start time.Time, logger *slog.Logger) (string, bool) {
+	config := v.config
+	syncClient, ok := v.client.(internal.ApplicationSyncClient)
+	if !ok {
+		return "client does not support syncing apps", true
+	}
+	logger.Info("Triggering sync of app in ArgoCD", "revision", config.TargetRevision)
+	appSyncer := internal.NewAppSyncer(syncClient, app, config.PollInterval, logger)
+	syncCtx, cancelSync := context.WithTimeout(ctx, v.remaining(start))
+	operationState, syncErr := appSyncer.Sync(syncCtx, internal.SyncSettings{
+		Revision: config.TargetRevision,
+		Prune:    config.SyncPrune,
+		Force:    config.SyncForce,
+		DryRun:   config.SyncDryRun,
+	})
+	cancelSync()
+	if syncErr != nil {
+		logger.Error("Failed to sync app", "error", syncErr)
+		return syncErr.Error(), false
+	}
+	if !operationState.Phase.Successful() {
+		logger.Error("Sync operation did not succeed", "phase", operationState.Phase, "message", operationState.Message)
+		return fmt.Sprintf("sync operation finished with phase %s: %s", operationState.Phase, operationState.Message), true
+	}
+	logger.Info("Sync operation succeeded")
+	return "", false
+}
+
+// check verifies a synced and healthy app with the verification mode.
+// It returns whether the app is in the expected state, why it is not, and whether that is a terminal failure.
+func (v *Verifier) check(ctx context.Context, app internal.AppRef, argoApp *v1alpha1.Application, resolver *internal.RevisionResolver, result *Result, logger *slog.Logger) (bool, string, bool) {
+	config := v.config
+	switch {
+	case config.VerifyMode == internal.Exact && len(config.TargetRevisions) > 0:
+		// Verify exact, per source
+		logger.Info("Fetched source revisions", "revisions", strings.Join(argoApp.Status.Sync.Revisions, ", "))
+		mismatches := internal.MismatchedSourceRevisions(config.TargetRevisions, argoApp)
+		if len(mismatches) > 0 {
+			for _, mismatch := range mismatches {
+				logger.Info("App is synced, healthy, but a source is not at the expected revision", "mismatch", mismatch.String())
+			}
+			return false, mismatches[0].String(), false
+		}
+		logger.Info("App is synced, healthy, and all sources are at the expected target revision")
+		return true, "", false
+
+	case config.VerifyMode == internal.Exact:
+		// Verify exact
+		match := internal.RevisionMatches(config.TargetRevision, argoApp.Status.Sync.Revision)
+		if !match && config.ResolveRevision && !internal.IsCommitSHA(config.TargetRevision) {
+			// Target revision is a tag or branch, check which commit it points to
+			match = v.resolve(ctx, resolver, argoApp.Status.Sync.Revision, logger)
+		}
+		if !match {
+			logger.Info("App is synced, healthy, but not at expected revision", "expected", config.TargetRevision, "revision", argoApp.Status.Sync.Revision)
+			return false, fmt.Sprintf("expected revision %s but found %s", config.TargetRevision, argoApp.Status.Sync.Revision), false
+		}
+		logger.Info("App is synced, healthy, and at the expected target revision")
+		return true, "", false
+
+	case config.VerifyMode == internal.Images:
+		// Verify deployed images
+		logger.Info("Fetched deployed images", "images", strings.Join(argoApp.Status.Summary.Images, ", "))
+		missingImages := internal.MissingImages(config.ExpectedImages, argoApp.Status.Summary.Images)
+		if len(missingImages) > 0 {
+			for _, image := range missingImages {
+				logger.Info("App is synced, healthy, but expected image is not deployed", "image", image.String())
+			}
+			return false, fmt.Sprintf("expected image %s is not deployed", missingImages[0]), false
+		}
+		logger.Info("App is synced, healthy, and runs all expected images")
+		return true, "", false
+
+	case config.VerifyMode == internal.HelmChartVersion:
+		// Verify Helm chart version
+		chart, chartErr := internal.FindHelmChart(argoApp, config.ChartName)
+		if chartErr != nil {
+			logger.Error("Failed to find Helm chart", "error", chartErr)
+			return false, chartErr.Error(), true
+		}
+		logger.Info("Fetched Helm chart", "chart", chart.Chart, "repoURL", chart.RepoURL, "version", chart.Version)
+		satisfied, versionErr := internal.ChartVersionSatisfies(config.ChartVersion, chart.Version)
+		if versionErr != nil {
+			logger.Warn("Unable to compare chart version", "error", versionErr)
+		}
+		if !satisfied {
+			logger.Info("App is synced, healthy, but chart version does not satisfy the constraint", "version", chart.Version, "constraint", config.ChartVersion.String())
+			return false, fmt.Sprintf("chart %s from %s version %s does not satisfy %s", chart.Chart, chart.RepoURL, chart.Version, config.ChartVersion), false
+		}
+		logger.Info("App is synced, healthy, and chart version matches expectation")
+		return true, "", false
+
+	default:
+		// Fetch metadata for commit message
+		revisionMetadata, fetchErr := v.client.RevisionMetadata(ctx, app.RevisionMetadataQuery(argoApp.Status.Sync.Revision))
+		if fetchErr != nil {
+			// Like a failed fetch of the app, the metadata is fetched again on the next attempt
+			logger.Warn("Failed to get revision metadata, retrying", "error", fetchErr)
+			return false, fmt.Sprintf("unable to get revision metadata for %s: %v", argoApp.Status.Sync.Revision, fetchErr), false
+		}
+
+		logger.Info("Fetched synced revision's message", "message", revisionMetadata.Message)
+		result.CommitMessage = revisionMetadata.Message
+		match, groups := internal.MatchCommitMessage(config, revisionMetadata.Message)
+		if !match {
+			logger.Info("App is synced, healthy, but commit message does not contain expected value")
+			return false, "commit message does not contain expected value", false
+		}
+		for name, value := range groups {
+			logger.Info("Commit message group", "group", name, "value", value)
+		}
+		logger.Info("App is synced, healthy, and commit message matches expectation")
+		return true, "", false
+	}
+}
+
+// resolve checks whether the target revision, a tag or branch, points to the synced commit.
+func (v *Verifier) resolve(ctx context.Context, resolver *internal.RevisionResolver, synced string, logger *slog.Logger) bool {
+	if resolver == nil {
+		logger.Warn("Client does not support resolving revisions")
+		return false
+	}
+	pointsTo, resolveErr := resolver.PointsTo(ctx, v.config.TargetRevision, synced)
+	if resolveErr != nil {
+		logger.Warn("Failed to resolve target revision", "error", resolveErr)
+	}
+	return pointsTo
+}
+
+// checkAborted marks the result as aborted when ctx was canceled, for example because KPCEA received SIGTERM.
+// A ctx that passed its deadline is not aborted, that is reported as a timeout.
+func (v *Verifier) checkAborted(ctx context.Context, result *Result, logger *slog.Logger) bool {
+	reason, aborted := AbortReason(ctx)
+	if !aborted {
+		return false
+	}
+	logger.Warn("Verification was aborted", "cause", context.Cause(ctx))
+	result.Status = Aborted
+	result.FailureReason = reason
+	return true
+}
+
+// AbortReason describes why the context was canceled, and whether it was canceled.
+// A context that reached its deadline is not aborted, the verification timed out.
+func AbortReason(ctx context.Context) (string, bool) {
+	if !errors.Is(ctx.Err(), context.Canceled) {
+		return "", false
+	}
+	return fmt.Sprintf("verification was aborted: %v", context.Cause(ctx)), true
+}
+
+// remaining returns how much time is left until the timeout.
+func (v *Verifier) remaining(start time.Time) time.Duration {
+	return v.config.PollTimeout - v.now().Sub(start)
+}
+
+func timeoutReason(timeout time.Duration, lastReason string) string {
+	if lastReason == "" {
+		return fmt.Sprintf("app did not reach the expected state within %s", timeout)
+	}
+	return fmt.Sprintf("app did not reach the expected state within %s: %s", timeout, lastReason)
+}
+
+// expectedRevision describes what the verification mode expects, like it is configured.
+func expectedRevision(config *internal.Config) string {
+	switch {
+	case config.VerifyMode == internal.Exact && len(config.TargetRevisions) > 0:
+		revisions := make([]string, 0, len(config.TargetRevisions))
+		for _, revision := range config.TargetRevisions {
+			revisions = append(revisions, revision.String())
+		}
+		return strings.Join(revisions, ";")
+	case config.VerifyMode == internal.Images:
+		images := make([]string, 0, len(config.ExpectedImages))
+		for _, image := range config.ExpectedImages {
+			images = append(images, image.String())
+		}
+		return strings.Join(images, ",")
+	case config.VerifyMode == internal.HelmChartVersion && config.ChartVersion != nil:
+		return config.ChartVersion.String()
+	default:
+		return config.TargetRevision
+	}
+}
@@ -0,0 +1,420 @@
+package verifier
+
+import (
+	"context"
+	"errors"
+	"github.com/Masterminds/semver/v3"
+	"github.com/argoproj/argo-cd/v2/pkg/apiclient/application"
+	"github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	repoapiclient "github.com/argoproj/argo-cd/v2/reposerver/apiclient"
+	"github.com/argoproj/gitops-engine/pkg/health"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"log/slog"
+	"regexp"
+	"rwslinkman/kargo-promotion-check-ext-argo/internal"
+	"testing"
+	"time"
+)
+
+var testLogger = slog.New(slog.DiscardHandler)
+
+const (
+	syncedRevision = "3f2a9c1d8e7b6a5f4e3d2c1b0a9f8e7d6c5b4a39"
+	otherRevision  = "9b8c7d6e5f4a3b2c1d0e9f8a7b6c5d4e3f2a1b0c"
+)
+
+var start = time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// MockClient returns the apps in order, and keeps returning the last app.
+// Every fetch moves the clock forward by the poll interval, so the timeout is reached without waiting.
+type MockClient struct {
+	apps         []*v1alpha1.Application
+	getErrs      []error
+	messages     map[string]string
+	metadataErrs []error
+	now          time.Time
+	interval     time.Duration
+}
+
+func (m *MockClient) Get(_ context.Context, _ *application.ApplicationQuery, _ ...grpc.CallOption) (*v1alpha1.Application, error) {
+	m.now = m.now.Add(m.interval)
+	if len(m.getErrs) > 0 {
+		err := m.getErrs[0]
+		m.getErrs = m.getErrs[1:]
+		return nil, err
+	}
+	app := m.apps[0]
+	if len(m.apps) > 1 {
+		m.apps = m.apps[1:]
+	}
+	return app, nil
+}
+
+func (m *MockClient) RevisionMetadata(_ context.Context, in *application.RevisionMetadataQuery, _ ...grpc.CallOption) (*v1alpha1.RevisionMetadata, error) {
+	if len(m.metadataErrs) > 0 {
+		err := m.metadataErrs[0]
+		m.metadataErrs = m.metadataErrs[1:]
+		return nil, err
+	}
+	message, ok := m.messages[in.GetRevision()]
+	if !ok {
+		return nil, errors.New("revision not found")
+	}
+	return &v1alpha1.RevisionMetadata{Message: message}, nil
+}
+
+// ResolvingMockClient resolves every symbolic revision to the same commit.
+type ResolvingMockClient struct {
+	MockClient
+	resolvedTo string
+	resolved   int
+}
+
+func (m *ResolvingMockClient) GetManifests(_ context.Context, _ *application.ApplicationManifestQuery, _ ...grpc.CallOption) (*repoapiclient.ManifestResponse, error) {
+	m.resolved++
+	return &repoapiclient.ManifestResponse{Revision: m.resolvedTo}, nil
+}
+
+func (m *MockClient) Now() time.Time {
+	return m.now
+}
+
+func newApp(syncStatus v1alpha1.SyncStatusCode, healthStatus health.HealthStatusCode, revision string) *v1alpha1.Application {
+	return &v1alpha1.Application{
+		Status: v1alpha1.ApplicationStatus{
+			Sync:   v1alpha1.SyncStatus{Status: syncStatus, Revision: revision},
+			Health: v1alpha1.HealthStatus{Status: healthStatus},
+		},
+	}
+}
+
+func newConfig(mode internal.VerificationMode) *internal.Config {
+	return &internal.Config{
+		VerifyMode:     mode,
+		TargetRevision: "3f2a9c1",
+		PollTimeout:    60 * time.Second,
+		WaitMode:       internal.PollWait,
+	}
+}
+
+func verify(config *internal.Config, client *MockClient) Result {
+	client.now = start
+	client.interval = 10 * time.Second
+	verifier := New(client, config, client.Now, testLogger)
+	return verifier.Verify(context.Background(), internal.AppRef{Name: "api"}, start)
+}
+
+func TestVerifier_Verify_Exact(t *testing.T) {
+	tests := []struct {
+		name         string
+		syncStatus   v1alpha1.SyncStatusCode
+		healthStatus health.HealthStatusCode
+		revision     string
+		status       Status
+		reason       string
+		attempts     int
+	}{
+		{"synced, healthy, at revision", v1alpha1.SyncStatusCodeSynced, health.HealthStatusHealthy, syncedRevision, InExpectedState, "", 1},
+		{"synced, healthy, other revision", v1alpha1.SyncStatusCodeSynced, health.HealthStatusHealthy, otherRevision, NotInExpectedState, "app did not reach the expected state within 1m0s: expected revision 3f2a9c1 but found " + otherRevision, 7},
+		{"synced, progressing, at revision", v1alpha1.SyncStatusCodeSynced, health.HealthStatusProgressing, syncedRevision, NotInExpectedState, "app did not reach the expected state within 1m0s: app is Synced and Progressing", 7},
+		{"synced, progressing, other revision", v1alpha1.SyncStatusCodeSynced, health.HealthStatusProgressing, otherRevision, NotInExpectedState, "app did not reach the expected state within 1m0s: app is Synced and Progressing", 7},
+		{"synced, degraded, at revision", v1alpha1.SyncStatusCodeSynced, health.HealthStatusDegraded, syncedRevision, TerminalFailure, "app health is Degraded", 1},
+		{"synced, missing, at revision", v1alpha1.SyncStatusCodeSynced, health.HealthStatusMissing, syncedRevision, NotInExpectedState, "app did not reach the expected state within 1m0s: app is Synced and Missing", 7},
+		{"out of sync, healthy, at revision", v1alpha1.SyncStatusCodeOutOfSync, health.HealthStatusHealthy, syncedRevision, NotInExpectedState, "app did not reach the expected state within 1m0s: app is OutOfSync and Healthy", 7},
+		{"out of sync, healthy, other revision", v1alpha1.SyncStatusCodeOutOfSync, health.HealthStatusHealthy, otherRevision, NotInExpectedState, "app did not reach the expected state within 1m0s: app is OutOfSync and Healthy", 7},
+		{"out of sync, progressing, at revision", v1alpha1.SyncStatusCodeOutOfSync, health.HealthStatusProgressing, syncedRevision, NotInExpectedState, "app did not reach the expected state within 1m0s: app is OutOfSync and Progressing", 7},
+		{"out of sync, degraded, other revision", v1alpha1.SyncStatusCodeOutOfSync, health.HealthStatusDegraded, otherRevision, NotInExpectedState, "app did not reach the expected state within 1m0s: app is OutOfSync and Degraded", 7},
+		{"unknown, unknown, no revision", v1alpha1.SyncStatusCodeUnknown, health.HealthStatusUnknown, "", NotInExpectedState, "app did not reach the expected state within 1m0s: app is Unknown and Unknown", 7},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := &MockClient{apps: []*v1alpha1.Application{newApp(test.syncStatus, test.healthStatus, test.revision)}}
+
+			result := verify(newConfig(internal.Exact), client)
+
+			assert.Equal(t, test.status, result.Status)
+			assert.Equal(t, test.reason, result.FailureReason)
+			assert.Equal(t, test.attempts, result.Attempts)
+			assert.Equal(t, test.revision, result.ObservedRevision)
+			assert.Equal(t, string(test.syncStatus), result.SyncStatus)
+			assert.Equal(t, string(test.healthStatus), result.HealthStatus)
+		})
+	}
+}
+
+func TestVerifier_Verify_ReachesExpectedStateAfterRollout(t *testing.T) {
+	client := &MockClient{apps: []*v1alpha1.Application{
+		newApp(v1alpha1.SyncStatusCodeOutOfSync, health.HealthStatusHealthy, otherRevision),
+		newApp(v1alpha1.SyncStatusCodeSynced, health.HealthStatusProgressing, syncedRevision),
+		newApp(v1alpha1.SyncStatusCodeSynced, health.HealthStatusHealthy, syncedRevision),
+	}}
+
+	result := verify(newConfig(internal.Exact), client)
+
+	assert.Equal(t, InExpectedState, result.Status)
+	assert.Equal(t, "", result.FailureReason)
+	assert.Equal(t, 3, result.Attempts)
+}
+
+func TestVerifier_Verify_CommitMessage(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     internal.VerificationMode
+		revision string
+		status   Status
+		reason   string
+	}{
+		{"search, message matches", internal.SearchCommitMessage, syncedRevision, InExpectedState, ""},
+		{"search, message does not match", internal.SearchCommitMessage, otherRevision, NotInExpectedState, "app did not reach the expected state within 1m0s: commit message does not contain expected value"},
+		{"regex, message matches", internal.RegexCommitMessage, syncedRevision, InExpectedState, ""},
+		{"regex, message does not match", internal.RegexCommitMessage, otherRevision, NotInExpectedState, "app did not reach the expected state within 1m0s: commit message does not contain expected value"},
+		{"revision metadata not found", internal.SearchCommitMessage, "unknown", NotInExpectedState, "app did not reach the expected state within 1m0s: unable to get revision metadata for unknown: revision not found"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := &MockClient{
+				apps: []*v1alpha1.Application{newApp(v1alpha1.SyncStatusCodeSynced, health.HealthStatusHealthy, test.revision)},
+				messages: map[string]string{
+					syncedRevision: "chore: promote api to v1.4.2",
+					otherRevision:  "chore: promote api to v1.4.1",
+				},
+			}
+			config := newConfig(test.mode)
+			config.SearchCommitMessage = "v1.4.2"
+			config.CommitMessageRegex = regexp.MustCompile(`promote (?P<app>\w+) to v1\.4\.2`)
+
+			result := verify(config, client)
+
+			assert.Equal(t, test.status, result.Status)
+			assert.Equal(t, test.reason, result.FailureReason)
+			assert.Equal(t, client.messages[test.revision], result.CommitMessage)
+		})
+	}
+}
+
+func TestVerifier_Verify_Images(t *testing.T) {
+	expectedImages, _ := internal.ParseExpectedImages("repo/api:1.4.2")
+	tests := []struct {
+		name   string
+		images []string
+		status Status
+		reason string
+	}{
+		{"image deployed", []string{"repo/api:1.4.2", "repo/sidecar:2.0.0"}, InExpectedState, ""},
+		{"image not deployed", []string{"repo/api:1.4.1"}, NotInExpectedState, "app did not reach the expected state within 1m0s: expected image repo/api:1.4.2 is not deployed"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := newApp(v1alpha1.SyncStatusCodeSynced, health.HealthStatusHealthy, syncedRevision)
+			app.Status.Summary.Images = test.images
+			client := &MockClient{apps: []*v1alpha1.Application{app}}
+			config := newConfig(internal.Images)
+			config.ExpectedImages = expectedImages
+
+			result := verify(config, client)
+
+			assert.Equal(t, test.status, result.Status)
+			assert.Equal(t, test.reason, result.FailureReason)
+		})
+	}
+}
+
+func TestVerifier_Verify_HelmChartVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		version string
+		status  Status
+		reason  string
+	}{
+		{"version satisfies constraint", "1.4.2", InExpectedState, ""},
+		{"version does not satisfy constraint", "1.3.0", NotInExpectedState, "app did not reach the expected state within 1m0s: chart api from https://charts.example.com version 1.3.0 does not satisfy >=1.4.0"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := newApp(v1alpha1.SyncStatusCodeSynced, health.HealthStatusHealthy, test.version)
+			app.Spec.Source = &v1alpha1.ApplicationSource{RepoURL: "https://charts.example.com", Chart: "api"}
+			client := &MockClient{apps: []*v1alpha1.Application{app}}
+			config := newConfig(internal.HelmChartVersion)
+			config.ChartVersion, _ = semver.NewConstraint(">=1.4.0")
+
+			result := verify(config, client)
+
+			assert.Equal(t, test.status, result.Status)
+			assert.Equal(t, test.reason, result.FailureReason)
+		})
+	}
+}
+
+func TestVerifier_Verify_HelmChartNotFound(t *testing.T) {
+	client := &MockClient{apps: []*v1alpha1.Application{newApp(v1alpha1.SyncStatusCodeSynced, health.HealthStatusHealthy, "1.4.2")}}
+
+	result := verify(newConfig(internal.HelmChartVersion), client)
+
+	assert.Equal(t, TerminalFailure, result.Status)
+	assert.NotEmpty(t, result.FailureReason)
+	assert.Equal(t, 1, result.Attempts)
+}
+
+func TestVerifier_Verify_ExpectedRevision(t *testing.T) {
+	targetRevisions, _ := internal.ParseTargetRevisions("https://github.com/org/charts=v2.3.0;abc123")
+	expectedImages, _ := internal.ParseExpectedImages("repo/api:1.4.2,repo/sidecar@sha256:abc")
+	chartVersion, _ := semver.NewConstraint(">=1.4.0")
+	tests := []struct {
+		name     string
+		config   func(config *internal.Config)
+		expected string
+	}{
+		{"target revision", func(config *internal.Config) {}, "3f2a9c1"},
+		{"source revisions", func(config *internal.Config) { config.TargetRevisions = targetRevisions }, "https://github.com/org/charts=v2.3.0;abc123"},
+		{"images", func(config *internal.Config) {
+			config.VerifyMode = internal.Images
+			config.ExpectedImages = expectedImages
+		}, "repo/api:1.4.2,repo/sidecar@sha256:abc"},
+		{"chart version", func(config *internal.Config) {
+			config.VerifyMode = internal.HelmChartVersion
+			config.ChartVersion = chartVersion
+		}, ">=1.4.0"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := &MockClient{apps: []*v1alpha1.Application{newApp(v1alpha1.SyncStatusCodeOutOfSync, health.HealthStatusHealthy, otherRevision)}}
+			config := newConfig(internal.Exact)
+			test.config(config)
+
+			result := verify(config, client)
+
+			assert.Equal(t, test.expected, result.ExpectedRevision)
+		})
+	}
+}
+
+func TestVerifier_Verify_RetriesFailedFetch(t *testing.T) {
+	client := &MockClient{
+		apps:    []*v1alpha1.Application{newApp(v1alpha1.SyncStatusCodeSynced, health.HealthStatusHealthy, syncedRevision)},
+		getErrs: []error{errors.New("connection refused")},
+	}
+
+	result := verify(newConfig(internal.Exact), client)
+
+	assert.Equal(t, InExpectedState, result.Status)
+	assert.Equal(t, 1, result.Attempts)
+}
+
+func TestVerifier_Verify_FetchKeepsFailing(t *testing.T) {
+	failure := errors.New("connection refused")
+	client := &MockClient{getErrs: []error{failure, failure, failure, failure, failure, failure, failure, failure}}
+
+	result := verify(newConfig(internal.Exact), client)
+
+	assert.Equal(t, NotInExpectedState, result.Status)
+	assert.Equal(t, "app did not reach the expected state within 1m0s: failed to fetch app details: connection refused", result.FailureReason)
+	assert.Equal(t, 0, result.Attempts)
+}
+
+func TestVerifier_Verify_RetriesFailedRevisionMetadata(t *testing.T) {
+	client := &MockClient{
+		apps:         []*v1alpha1.Application{newApp(v1alpha1.SyncStatusCodeSynced, health.HealthStatusHealthy, syncedRevision)},
+		messages:     map[string]string{syncedRevision: "chore: promote api to v1.4.2"},
+		metadataErrs: []error{errors.New("connection refused")},
+	}
+	config := newConfig(internal.SearchCommitMessage)
+	config.SearchCommitMessage = "v1.4.2"
+
+	result := verify(config, client)
+
+	assert.Equal(t, InExpectedState, result.Status)
+	assert.Equal(t, 2, result.Attempts)
+}
+
+func TestVerifier_Verify_StabilityWindow(t *testing.T) {
+	client := &MockClient{apps: []*v1alpha1.Application{
+		newApp(v1alpha1.SyncStatusCodeSynced, health.HealthStatusHealthy, syncedRevision),
+		newApp(v1alpha1.SyncStatusCodeSynced, health.HealthStatusProgressing, syncedRevision),
+		newApp(v1alpha1.SyncStatusCodeSynced, health.HealthStatusHealthy, syncedRevision),
+	}}
+	config := newConfig(internal.Exact)
+	config.StableFor = 20 * time.Second
+
+	result := verify(config, client)
+
+	assert.Equal(t, InExpectedState, result.Status)
+	assert.Equal(t, 5, result.Attempts)
+}
+
+func TestVerifier_Verify_Aborted(t *testing.T) {
+	client := &MockClient{apps: []*v1alpha1.Application{newApp(v1alpha1.SyncStatusCodeOutOfSync, health.HealthStatusHealthy, otherRevision)}}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	config := newConfig(internal.Exact)
+	config.PollInterval = time.Second
+
+	result := New(client, config, time.Now, testLogger).Verify(ctx, internal.AppRef{Name: "api"}, time.Now())
+
+	assert.Equal(t, Aborted, result.Status)
+	assert.Equal(t, "verification was aborted: context canceled", result.FailureReason)
+}
+
+func TestVerifier_Verify_WatchNotSupported(t *testing.T) {
+	client := &MockClient{}
+	config := newConfig(internal.Exact)
+	config.WaitMode = internal.WatchWait
+
+	result := verify(config, client)
+
+	assert.Equal(t, TerminalFailure, result.Status)
+	assert.Equal(t, "client does not support watching apps", result.FailureReason)
+}
+
+func TestVerifier_Verify_AbortedWithCause(t *testing.T) {
+	client := &MockClient{apps: []*v1alpha1.Application{newApp(v1alpha1.SyncStatusCodeSynced, health.HealthStatusHealthy, syncedRevision)}}
+	ctx, cancel := context.WithCancelCause(context.Background())
+	cancel(errors.New("terminated signal received"))
+
+	result := New(client, newConfig(internal.SearchCommitMessage), time.Now, testLogger).Verify(ctx, internal.AppRef{Name: "api"}, time.Now())
+
+	assert.Equal(t, Aborted, result.Status)
+	assert.Equal(t, "verification was aborted: terminated signal received", result.FailureReason)
+}
+
+func TestVerifier_Verify_DeadlineIsTimeout(t *testing.T) {
+	client := &MockClient{apps: []*v1alpha1.Application{newApp(v1alpha1.SyncStatusCodeOutOfSync, health.HealthStatusHealthy, syncedRevision)}}
+	config := newConfig(internal.Exact)
+	config.PollInterval = time.Second
+	config.PollTimeout = 1500 * time.Millisecond
+	start := time.Now()
+	ctx, cancel := context.WithDeadline(context.Background(), start.Add(config.PollTimeout))
+	defer cancel()
+
+	result := New(client, config, time.Now, testLogger).Verify(ctx, internal.AppRef{Name: "api"}, start)
+
+	assert.Equal(t, NotInExpectedState, result.Status)
+	assert.Equal(t, "app did not reach the expected state within 1.5s: app is OutOfSync and Healthy", result.FailureReason)
+	assert.Equal(t, 2, result.Attempts)
+}
+
+func TestVerifier_Verify_ResolvesSymbolicRevisionOncePerSyncedCommit(t *testing.T) {
+	client := &ResolvingMockClient{
+		MockClient: MockClient{
+			apps: []*v1alpha1.Application{
+				newApp(v1alpha1.SyncStatusCodeSynced, health.HealthStatusHealthy, otherRevision),
+				newApp(v1alpha1.SyncStatusCodeSynced, health.HealthStatusHealthy, otherRevision),
+				newApp(v1alpha1.SyncStatusCodeSynced, health.HealthStatusHealthy, otherRevision),
+				newApp(v1alpha1.SyncStatusCodeSynced, health.HealthStatusHealthy, syncedRevision),
+			},
+			messages: map[string]string{otherRevision: "", syncedRevision: ""},
+			now:      start,
+			interval: 10 * time.Second,
+		},
+		resolvedTo: syncedRevision,
+	}
+	config := newConfig(internal.Exact)
+	config.TargetRevision = "main"
+	config.ResolveRevision = true
+
+	result := New(client, config, client.Now, testLogger).Verify(context.Background(), internal.AppRef{Name: "api"}, start)
+
+	assert.Equal(t, InExpectedState, result.Status)
+	assert.Equal(t, 4, result.Attempts)
+	assert.Equal(t, 2, client.resolved)
+}
@@ -2,126 +2,357 @@ package main
 
 import (
 	"context"
-	"crypto/tls"
+	"errors"
 	"fmt"
 	"github.com/argoproj/argo-cd/v2/pkg/apiclient"
 	"github.com/argoproj/argo-cd/v2/pkg/apiclient/application"
+	"github.com/argoproj/argo-cd/v2/pkg/apiclient/applicationset"
+	"io"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
 	"rwslinkman/kargo-promotion-check-ext-argo/internal"
-	"strings"
+	"rwslinkman/kargo-promotion-check-ext-argo/internal/verifier"
+	"slices"
+	"sync"
+	"syscall"
 	"time"
 )
 
+const (
+	exitSuccess         = 0
+	exitNotInState      = 1
+	exitTerminalFailure = 2
+	exitAborted         = 3
+	exitSetupFailure    = 4
+)
+
+const terminationLogPath = "/dev/termination-log"
+
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "serve":
+			serve()
+			return
+		case "rollouts-plugin":
+			servePlugin()
+			return
+		}
+	}
+
 	config, err := internal.LoadConfig()
 	if err != nil {
-		panic(err)
+		// Without a valid configuration, log and report with the defaults
+		logger := internal.NewLogger(os.Stderr, internal.TextLog, slog.LevelInfo, internal.NewRedactor())
+		logger.Error("Invalid configuration", "error", err)
+		fallbackConfig := &internal.Config{Output: internal.OutputFormat(os.Getenv("KPCEA_OUTPUT"))}
+		exit(context.Background(), fallbackConfig, logger, newSetupReport(time.Now(), err))
+	}
+
+	// Logs go to stderr when stdout is reserved for the JSON result
+	logOutput := os.Stdout
+	if config.Output == internal.JsonOutput {
+		logOutput = os.Stderr
+	}
+	redactor := internal.NewRedactor(config.ArgoApiToken, config.ApiPassword)
+	logger := internal.NewLogger(logOutput, config.LogFormat, config.LogLevel, redactor)
+	logger.Info("KPCEA started", "authMode", config.AuthMode)
+
+	// Stop when Kubernetes terminates the pod, for example because Kargo aborted the verification, or when the timeout is reached
+	start := time.Now()
+	signalCtx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	ctx, cancel := context.WithDeadline(signalCtx, start.Add(config.PollTimeout))
+	defer cancel()
+
+	argoAppClient, argoAppSetClient, err := connect(ctx, config, redactor, logger)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			// Not a setup failure, ArgoCD did not respond before the timeout
+			exit(ctx, config, logger, newReport(start, nil, fmt.Sprintf("unable to connect to ArgoCD within %s: %v", config.PollTimeout, err)))
+		}
+		exit(ctx, config, logger, newSetupReport(start, err))
+	}
+	apps, findErr := findApps(ctx, config, argoAppClient, argoAppSetClient, logger)
+	if findErr != nil {
+		logger.Error("Failed to find apps to verify", "error", findErr)
+		exit(ctx, config, logger, newReport(start, nil, findErr.Error()))
+	}
+	results := verifyApps(ctx, config, argoAppClient, apps, start, logger)
+	exit(ctx, config, logger, newReport(start, results, ""))
+}
+
+// connect gets an API token when needed, and creates the clients to interact with the external Argo CD instance.
+func connect(ctx context.Context, config *internal.Config, redactor *internal.Redactor, logger *slog.Logger) (application.ApplicationServiceClient, applicationset.ApplicationSetServiceClient, error) {
+	tlsConfig, err := internal.NewTLSConfig(config)
+	if err != nil {
+		logger.Error("Invalid TLS configuration", "error", err)
+		return nil, nil, err
 	}
-	fmt.Printf("KPCEA started in %s mode \n", config.AuthMode)
 
 	argoApiToken := config.ArgoApiToken // might be nil
+	var tokenSource internal.TokenSource
+	if config.ArgoApiTokenFile != "" {
+		// Token is rotated in the file
+		tokenSource = internal.FileTokenSource(config.ArgoApiTokenFile)
+	}
 	if config.AuthMode == internal.LoginMode {
 		// ensure having an API Token
 		client := &http.Client{
 			Transport: &http.Transport{
-				TLSClientConfig: &tls.Config{
-					InsecureSkipVerify: config.AllowInsecure,
-				},
+				TLSClientConfig: tlsConfig,
 			},
 		}
-		argoApiClient := internal.NewArgoLoginClient(client)
-		var apiToken, err = argoApiClient.GetApiToken(config.ArgoServer, config.ApiUsername, config.ApiPassword, config.AllowInsecure)
+		argoApiClient := internal.NewArgoLoginClient(client, logger)
+		login := func(ctx context.Context) (string, error) {
+			return argoApiClient.GetApiToken(ctx, config.ArgoServerWithBasePath(), config.ApiUsername, config.ApiPassword, config.PlainText)
+		}
+		var apiToken, err = login(ctx)
 		if err != nil {
-			fmt.Println("Unable to get API token from ArgoCD: ", err)
-			panic(err)
+			logger.Error("Unable to get API token from ArgoCD", "error", err)
+			return nil, nil, err
 		}
+		redactor.Add(apiToken)
 		argoApiToken = apiToken
-		fmt.Println("Successfully got a temporary API token from ArgoCD")
+		logger.Info("Successfully got a temporary API token from ArgoCD")
+		// The session expires, log in again when the token is rejected
+		tokenSource = login
 	}
 
 	// Create API client with API token to interact with external Argo CD instance
 	clientOpts := apiclient.ClientOptions{
-		ServerAddr: config.ArgoServer,
-		AuthToken:  argoApiToken,
-		GRPCWeb:    true,
-		Insecure:   config.AllowInsecure,
+		ServerAddr:        config.ArgoServer,
+		AuthToken:         argoApiToken,
+		GRPCWeb:           !config.UseGRPC,
+		GRPCWebRootPath:   config.GRPCWebRootPath,
+		PlainText:         config.PlainText,
+		Insecure:          config.TLSSkipVerify,
+		CertFile:          config.CAFile,
+		ClientCertFile:    config.ClientCertFile,
+		ClientCertKeyFile: config.ClientKeyFile,
 	}
-	argoApiClient := apiclient.NewClientOrDie(&clientOpts)
-	fmt.Println("ArgoCD API client created")
+	var appCloser, appSetCloser io.Closer
+	var argoAppClient application.ApplicationServiceClient
+	var argoAppSetClient applicationset.ApplicationSetServiceClient
+	// The ArgoCD client probes gRPC and dials ArgoCD without a context, stop waiting for it on SIGTERM or timeout
+	err = waitFor(ctx, func() error {
+		argoApiClient, clientErr := apiclient.NewClient(&clientOpts)
+		if clientErr != nil {
+			logger.Error("Unable to create ArgoCD API client", "error", clientErr)
+			return clientErr
+		}
+		logger.Info("ArgoCD API client created", "server", config.ArgoServerWithBasePath())
 
-	_, argoAppClient := argoApiClient.NewApplicationClientOrDie()
-	appQuery := application.ApplicationQuery{Name: &config.ArgoAppName}
+		appCloser, argoAppClient, clientErr = argoApiClient.NewApplicationClient()
+		if clientErr != nil {
+			logger.Error("Unable to create ArgoCD application client", "error", clientErr)
+			return clientErr
+		}
+		appSetCloser, argoAppSetClient, clientErr = argoApiClient.NewApplicationSetClient()
+		if clientErr != nil {
+			logger.Error("Unable to create ArgoCD ApplicationSet client", "error", clientErr)
+			return clientErr
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if tokenSource != nil {
+		// Create a new client with a new token when the current token is rejected
+		newApiClient := func(token string) (apiclient.Client, error) {
+			redactor.Add(token)
+			reloadedOpts := clientOpts
+			reloadedOpts.AuthToken = token
+			return apiclient.NewClient(&reloadedOpts)
+		}
+		argoAppClient = internal.NewReloadingAppClient(argoAppClient, appCloser, argoApiToken, tokenSource, func(token string) (io.Closer, application.ApplicationServiceClient, error) {
+			reloadedApiClient, clientErr := newApiClient(token)
+			if clientErr != nil {
+				return nil, nil, clientErr
+			}
+			return reloadedApiClient.NewApplicationClient()
+		}, logger)
+		argoAppSetClient = internal.NewReloadingAppSetClient(argoAppSetClient, appSetCloser, argoApiToken, tokenSource, func(token string) (io.Closer, applicationset.ApplicationSetServiceClient, error) {
+			reloadedApiClient, clientErr := newApiClient(token)
+			if clientErr != nil {
+				return nil, nil, clientErr
+			}
+			return reloadedApiClient.NewApplicationSetClient()
+		}, logger)
+	}
+	return argoAppClient, argoAppSetClient, nil
+}
 
-	ctx := context.Background()
-	start := time.Now()
-	success := false
-
-	for {
-		if time.Since(start) > config.PollTimeout {
-			fmt.Println("Timeout reached while waiting for app to sync")
-			break
-		}
-
-		fmt.Println("Fetching app details from ArgoCD...")
-		argoApp, getErr := argoAppClient.Get(ctx, &appQuery)
-		if getErr != nil {
-			fmt.Printf("Failed to fetch App details: %v\n", getErr)
-			fmt.Println("Retrying failed request")
-			continue
-		}
-
-		fmt.Println("Sync Status:", argoApp.Status.Sync.Status)
-		fmt.Println("Sync Revision:", argoApp.Status.Sync.Revision)
-		fmt.Println("Health Status:", argoApp.Status.Health.Status)
-
-		if argoApp.Status.Sync.Status == "Synced" && argoApp.Status.Health.Status == "Healthy" {
-			if config.VerifyMode == internal.Exact {
-				// Verify exact
-				if argoApp.Status.Sync.Revision == config.TargetRevision {
-					fmt.Println("App is synced, healthy, and at the expected target revision!")
-					success = true
-					break
-				} else {
-					fmt.Printf("App is synced, healthy, but not at expected revision. Expected %s but found %s \n", config.TargetRevision, argoApp.Status.Sync.Revision)
-				}
-			} else {
-				// Fetch metadata for commit message
-				revisionMetadata, fetchErr := argoAppClient.RevisionMetadata(ctx, &application.RevisionMetadataQuery{
-					Name:     &config.ArgoAppName,
-					Revision: &argoApp.Status.Sync.Revision,
-				})
-				if fetchErr != nil {
-					fmt.Printf("Failed to get revision metadata: %v\n", fetchErr)
-					panic(fetchErr)
-				}
-
-				fmt.Println("Synced Revision's Message: " + revisionMetadata.Message)
-				match := strings.Contains(revisionMetadata.Message, config.SearchCommitMessage)
-				if match {
-					fmt.Println("App is synced, healthy, and commit message matches expectation!")
-					success = true
-					break
-				} else {
-					fmt.Println("App is synced, healthy, but commit message does not contain expected value")
-				}
+// waitFor runs fn, but returns the error of ctx when ctx is done before fn returns.
+// fn keeps running in the background, so it must not change anything that is used after waitFor returned an error.
+func waitFor(ctx context.Context, fn func() error) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// findApps collects the apps to verify, by name, by label selector and by ApplicationSet.
+func findApps(ctx context.Context, config *internal.Config, argoAppClient application.ApplicationServiceClient, argoAppSetClient internal.ApplicationSetGetClient, logger *slog.Logger) ([]internal.AppRef, error) {
+	var apps []internal.AppRef
+	for _, appName := range config.ArgoAppNames {
+		apps = append(apps, internal.ParseAppRef(appName, config.ArgoAppNamespace, config.ArgoAppProject))
+	}
+	if config.AppSelector != "" {
+		// Find all apps matching the label selector
+		listQuery := &application.ApplicationQuery{Selector: &config.AppSelector}
+		if config.ArgoAppNamespace != "" {
+			listQuery.AppNamespace = &config.ArgoAppNamespace
+		}
+		if config.ArgoAppProject != "" {
+			listQuery.Project = []string{config.ArgoAppProject}
+		}
+		appList, listErr := argoAppClient.List(ctx, listQuery)
+		if listErr != nil {
+			return nil, fmt.Errorf("unable to list apps matching selector '%s': %v", config.AppSelector, listErr)
+		}
+		for _, app := range appList.Items {
+			appRef := internal.AppRef{Name: app.Name, Namespace: app.Namespace, Project: config.ArgoAppProject}
+			if !slices.Contains(apps, appRef) {
+				apps = append(apps, appRef)
+			}
+		}
+		logger.Info("Found apps matching selector", "selector", config.AppSelector, "count", len(appList.Items))
+	}
+	if config.AppSetName != "" {
+		// Find all apps that the ApplicationSet currently generates
+		appSet := internal.ParseAppRef(config.AppSetName, config.ArgoAppNamespace, config.ArgoAppProject)
+		generatedApps, appSetErr := internal.GeneratedApps(ctx, argoAppSetClient, appSet, config.ExpectedAppCount)
+		if appSetErr != nil {
+			return nil, appSetErr
+		}
+		for _, appRef := range generatedApps {
+			if !slices.Contains(apps, appRef) {
+				apps = append(apps, appRef)
 			}
+		}
+		logger.Info("Found apps generated by ApplicationSet", "appSet", appSet.String(), "count", len(generatedApps))
+	}
+	if len(apps) == 0 {
+		return nil, fmt.Errorf("no apps to verify")
+	}
+	return apps, nil
+}
 
-		} else {
-			fmt.Println("App is not in sync, retrying..")
+// verifyApps verifies all apps concurrently, and returns the result per app in the same order.
+func verifyApps(ctx context.Context, config *internal.Config, argoAppClient application.ApplicationServiceClient, apps []internal.AppRef, start time.Time, logger *slog.Logger) []internal.AppResult {
+	appVerifier := verifier.New(argoAppClient, config, time.Now, logger)
+	results := make([]internal.AppResult, len(apps))
+	var wg sync.WaitGroup
+	for i, app := range apps {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = appResult(app, appVerifier.Verify(ctx, app, start))
+			results[i].ElapsedSeconds = time.Since(start).Seconds()
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// appResult converts the result of the verifier to the result that is reported for the app.
+func appResult(app internal.AppRef, result verifier.Result) internal.AppResult {
+	exitCode := exitNotInState
+	switch result.Status {
+	case verifier.InExpectedState:
+		exitCode = exitSuccess
+	case verifier.TerminalFailure:
+		exitCode = exitTerminalFailure
+	case verifier.Aborted:
+		exitCode = exitAborted
+	}
+	return internal.AppResult{
+		App:              app.String(),
+		ExpectedRevision: result.ExpectedRevision,
+		ObservedRevision: result.ObservedRevision,
+		SyncStatus:       result.SyncStatus,
+		HealthStatus:     result.HealthStatus,
+		CommitMessage:    result.CommitMessage,
+		Attempts:         result.Attempts,
+		FailureReason:    result.FailureReason,
+		ExitCode:         exitCode,
+	}
+}
+
+func exit(ctx context.Context, config *internal.Config, logger *slog.Logger, report internal.Report) {
+	for _, result := range report.Apps {
+		switch result.ExitCode {
+		case exitSuccess:
+			logger.Info("Argo App is currently in expected state", "app", result.App)
+		case exitAborted:
+			logger.Warn("Verification of Argo App was aborted", "app", result.App, "reason", result.FailureReason)
+		default:
+			logger.Error("Argo App is currently NOT in expected state", "app", result.App, "reason", result.FailureReason)
 		}
+	}
+	if abortReason, aborted := verifier.AbortReason(ctx); aborted && report.ExitCode != exitSuccess {
+		// Not a failed verification, the verification did not finish
+		report.ExitCode = exitAborted
+		report.FailureReason = abortReason
+	}
+	if config.Output == internal.JsonOutput {
+		writeReport(logger, &report)
+	}
+	if report.ExitCode == exitAborted {
+		logger.Warn("KPCEA was aborted before the verification finished", "exitCode", report.ExitCode, "reason", report.FailureReason)
+	} else {
+		logger.Info("KPCEA completed", "exitCode", report.ExitCode)
+	}
+	os.Exit(report.ExitCode)
+}
 
-		// Success state not reached, try again after interval
-		time.Sleep(config.PollInterval)
+// newReport combines the results of all apps, the most severe exit code of all apps is used.
+func newReport(start time.Time, results []internal.AppResult, failureReason string) internal.Report {
+	exitCode := exitSuccess
+	for _, result := range results {
+		exitCode = max(exitCode, result.ExitCode)
 	}
+	if len(results) == 0 {
+		exitCode = exitNotInState
+	}
+	return internal.Report{
+		InExpectedState: exitCode == exitSuccess,
+		ExitCode:        exitCode,
+		ElapsedSeconds:  time.Since(start).Seconds(),
+		FailureReason:   failureReason,
+		Apps:            results,
+	}
+}
+
+// newSetupReport reports that the verification could not start, because the configuration is invalid or ArgoCD could not be reached.
+func newSetupReport(start time.Time, err error) internal.Report {
+	report := newReport(start, nil, err.Error())
+	report.ExitCode = exitSetupFailure
+	return report
+}
 
-	var exitCode = 1
-	var exitMsgPart = " NOT"
-	if success {
-		exitCode = 0
-		exitMsgPart = ""
+// writeReport prints the report and writes it to the termination log, so Kubernetes shows it in the status of the pod.
+func writeReport(logger *slog.Logger, report *internal.Report) {
+	if err := report.WriteJSON(os.Stdout); err != nil {
+		logger.Error("Failed to write JSON output", "error", err)
+	}
+	terminationLog, err := os.OpenFile(terminationLogPath, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		// Not running in Kubernetes
+		return
+	}
+	defer terminationLog.Close()
+	if err = report.WriteJSON(terminationLog); err != nil {
+		logger.Error("Failed to write termination log", "error", err)
 	}
-	fmt.Printf("Argo App '%s' is currently%s in expected state\n", config.ArgoAppName, exitMsgPart)
-	fmt.Println("KPCEA completed")
-	os.Exit(exitCode)
 }
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/argoproj/argo-cd/v2/pkg/apiclient/application"
+	"github.com/argoproj/argo-cd/v2/pkg/apiclient/applicationset"
+	"github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"rwslinkman/kargo-promotion-check-ext-argo/internal"
+	"testing"
+	"time"
+)
+
+// MockListAppClient lists the apps, and records the selector of the last query.
+type MockListAppClient struct {
+	application.ApplicationServiceClient
+	apps     []v1alpha1.Application
+	listErr  error
+	selector string
+}
+
+func (m *MockListAppClient) List(_ context.Context, in *application.ApplicationQuery, _ ...grpc.CallOption) (*v1alpha1.ApplicationList, error) {
+	m.selector = in.GetSelector()
+	if m.listErr != nil {
+		return nil, m.listErr
+	}
+	return &v1alpha1.ApplicationList{Items: m.apps}, nil
+}
+
+// MockAppSetClient returns an ApplicationSet that generates the apps.
+type MockAppSetClient struct {
+	apps []v1alpha1.ResourceStatus
+}
+
+func (m *MockAppSetClient) Get(_ context.Context, _ *applicationset.ApplicationSetGetQuery, _ ...grpc.CallOption) (*v1alpha1.ApplicationSet, error) {
+	return &v1alpha1.ApplicationSet{Status: v1alpha1.ApplicationSetStatus{Resources: m.apps}}, nil
+}
+
+func listedApp(namespace string, name string) v1alpha1.Application {
+	return v1alpha1.Application{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}}
+}
+
+func TestFindApps(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   *internal.Config
+		listed   []v1alpha1.Application
+		appSet   []v1alpha1.ResourceStatus
+		expected []internal.AppRef
+	}{
+		{
+			"comma-separated list",
+			&internal.Config{ArgoAppNames: []string{"api", "team-payments/worker"}},
+			nil,
+			nil,
+			[]internal.AppRef{{Name: "api"}, {Name: "worker", Namespace: "team-payments"}},
+		},
+		{
+			"list and selector are merged without duplicates",
+			&internal.Config{ArgoAppNames: []string{"argocd/api", "worker"}, AppSelector: "team=payments"},
+			[]v1alpha1.Application{listedApp("argocd", "api"), listedApp("argocd", "cron")},
+			nil,
+			[]internal.AppRef{{Name: "api", Namespace: "argocd"}, {Name: "worker"}, {Name: "cron", Namespace: "argocd"}},
+		},
+		{
+			"selector and ApplicationSet are merged without duplicates",
+			&internal.Config{AppSelector: "team=payments", AppSetName: "regions"},
+			[]v1alpha1.Application{listedApp("argocd", "api-eu")},
+			[]v1alpha1.ResourceStatus{
+				{Kind: "Application", Name: "api-eu", Namespace: "argocd"},
+				{Kind: "Application", Name: "api-us", Namespace: "argocd"},
+			},
+			[]internal.AppRef{{Name: "api-eu", Namespace: "argocd"}, {Name: "api-us", Namespace: "argocd"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			appClient := &MockListAppClient{apps: test.listed}
+			appSetClient := &MockAppSetClient{apps: test.appSet}
+
+			apps, err := findApps(context.Background(), test.config, appClient, appSetClient, testLogger)
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, apps)
+			assert.Equal(t, test.config.AppSelector, appClient.selector)
+		})
+	}
+}
+
+func TestFindApps_NoApps(t *testing.T) {
+	config := &internal.Config{AppSelector: "team=payments"}
+
+	apps, err := findApps(context.Background(), config, &MockListAppClient{}, &MockAppSetClient{}, testLogger)
+
+	assert.Nil(t, apps)
+	assert.EqualError(t, err, "no apps to verify")
+}
+
+func TestFindApps_ListFails(t *testing.T) {
+	config := &internal.Config{ArgoAppNames: []string{"api"}, AppSelector: "team=payments"}
+	appClient := &MockListAppClient{listErr: errors.New("permission denied")}
+
+	apps, err := findApps(context.Background(), config, appClient, &MockAppSetClient{}, testLogger)
+
+	assert.Nil(t, apps)
+	assert.EqualError(t, err, "unable to list apps matching selector 'team=payments': permission denied")
+}
+
+func TestNewReport(t *testing.T) {
+	tests := []struct {
+		name            string
+		exitCodes       []int
+		inExpectedState bool
+		exitCode        int
+	}{
+		{"all apps in expected state", []int{exitSuccess, exitSuccess}, true, exitSuccess},
+		{"one app not in expected state", []int{exitSuccess, exitNotInState}, false, exitNotInState},
+		{"terminal failure is more severe than not in expected state", []int{exitNotInState, exitTerminalFailure, exitSuccess}, false, exitTerminalFailure},
+		{"aborted is the most severe", []int{exitTerminalFailure, exitAborted}, false, exitAborted},
+		{"no apps", nil, false, exitNotInState},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var results []internal.AppResult
+			for _, exitCode := range test.exitCodes {
+				results = append(results, internal.AppResult{ExitCode: exitCode})
+			}
+
+			report := newReport(time.Now(), results, "")
+
+			assert.Equal(t, test.inExpectedState, report.InExpectedState)
+			assert.Equal(t, test.exitCode, report.ExitCode)
+			assert.Equal(t, results, report.Apps)
+		})
+	}
+}
+
+func TestWaitFor_ReturnsErrorOfFn(t *testing.T) {
+	err := waitFor(context.Background(), func() error {
+		return errors.New("connection refused")
+	})
+
+	assert.EqualError(t, err, "connection refused")
+}
+
+func TestWaitFor_StopsWaitingWhenContextIsDone(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	blocked := make(chan struct{})
+	defer close(blocked)
+
+	err := waitFor(ctx, func() error {
+		<-blocked
+		return nil
+	})
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/argoproj/argo-cd/v2/pkg/apiclient/application"
+	"github.com/argoproj/argo-rollouts/metricproviders/plugin/rpc"
+	"github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+	"github.com/argoproj/argo-rollouts/utils/evaluate"
+	metricutil "github.com/argoproj/argo-rollouts/utils/metric"
+	"github.com/argoproj/argo-rollouts/utils/plugin/types"
+	goPlugin "github.com/hashicorp/go-plugin"
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"log/slog"
+	"os"
+	"os/signal"
+	"rwslinkman/kargo-promotion-check-ext-argo/internal"
+	"rwslinkman/kargo-promotion-check-ext-argo/internal/verifier"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// pluginName is the name of the plugin in the Argo Rollouts configuration and in the AnalysisTemplates
+	pluginName = "rwslinkman/kpcea"
+	// checkMetadataKey holds the identifier of the running check in the metadata of the measurement
+	checkMetadataKey = "kpceaCheck"
+)
+
+// servePlugin runs KPCEA as a metric provider plugin of Argo Rollouts.
+// Argo Rollouts starts the plugin and talks to it over RPC, so the logs are written to stderr.
+func servePlugin() {
+	config, err := internal.LoadServerConfig()
+	if err != nil {
+		logger := internal.NewLogger(os.Stderr, internal.TextLog, slog.LevelInfo, internal.NewRedactor())
+		logger.Error("Invalid configuration", "error", err)
+		os.Exit(exitSetupFailure)
+	}
+
+	redactor := internal.NewRedactor(config.ArgoApiToken, config.ApiPassword)
+	logger := internal.NewLogger(os.Stderr, config.LogFormat, config.LogLevel, redactor)
+	logger.Info("KPCEA plugin started", "authMode", config.AuthMode)
+
+	// Stop when Argo Rollouts is terminated, this also cancels logging in and the running checks
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	argoAppClient, argoAppSetClient, err := connect(ctx, config, redactor, logger)
+	if err != nil {
+		if reason, aborted := verifier.AbortReason(ctx); aborted {
+			logger.Warn("KPCEA plugin was stopped before it connected to ArgoCD", "reason", reason)
+			os.Exit(exitAborted)
+		}
+		// The reason was logged by connect
+		os.Exit(exitSetupFailure)
+	}
+	metricPlugin := newRolloutsPlugin(ctx, argoAppClient, argoAppSetClient, logger)
+	go func() {
+		// Serve does not return, exit once the aborted checks are done
+		<-ctx.Done()
+		metricPlugin.wait()
+		logger.Info("KPCEA plugin stopped", "reason", context.Cause(ctx))
+		os.Exit(exitSuccess)
+	}()
+
+	goPlugin.Serve(&goPlugin.ServeConfig{
+		HandshakeConfig: goPlugin.HandshakeConfig{
+			ProtocolVersion:  1,
+			MagicCookieKey:   "ARGO_ROLLOUTS_RPC_PLUGIN",
+			MagicCookieValue: "metricprovider",
+		},
+		Plugins: map[string]goPlugin.Plugin{
+			"RpcMetricProviderPlugin": &rpc.RpcMetricProviderPlugin{Impl: metricPlugin},
+		},
+	})
+}
+
+// pluginCheck is a verification that runs in the background, while Argo Rollouts resumes the measurement until it is done.
+type pluginCheck struct {
+	cancel   context.CancelFunc
+	interval time.Duration
+	done     chan struct{}
+	report   internal.Report
+}
+
+// rolloutsPlugin implements the metric provider plugin interface of Argo Rollouts.
+// Every measurement verifies the apps that are configured in the metric, the report of the verification is the value of the measurement.
+type rolloutsPlugin struct {
+	// ctx stops all checks when the plugin is stopped
+	ctx              context.Context
+	argoAppClient    application.ApplicationServiceClient
+	argoAppSetClient internal.ApplicationSetGetClient
+	logger           *slog.Logger
+	mu               sync.Mutex
+	checks           map[string]*pluginCheck
+}
+
+func newRolloutsPlugin(ctx context.Context, argoAppClient application.ApplicationServiceClient, argoAppSetClient internal.ApplicationSetGetClient, logger *slog.Logger) *rolloutsPlugin {
+	return &rolloutsPlugin{
+		ctx:              ctx,
+		argoAppClient:    argoAppClient,
+		argoAppSetClient: argoAppSetClient,
+		logger:           logger,
+		checks:           map[string]*pluginCheck{},
+	}
+}
+
+func (p *rolloutsPlugin) InitPlugin() types.RpcError {
+	return types.RpcError{}
+}
+
+// Run starts the verification in the background, since it takes longer than Argo Rollouts waits for a measurement.
+func (p *rolloutsPlugin) Run(analysisRun *v1alpha1.AnalysisRun, metric v1alpha1.Metric) v1alpha1.Measurement {
+	startedAt := metav1.Now()
+	measurement := v1alpha1.Measurement{StartedAt: &startedAt}
+	params, err := internal.PluginCheckParams(metric.Provider.Plugin[pluginName])
+	if err != nil {
+		return metricutil.MarkMeasurementError(measurement, err)
+	}
+	checkConfig, err := internal.LoadCheckConfig(params)
+	if err != nil {
+		return metricutil.MarkMeasurementError(measurement, err)
+	}
+
+	checkId := fmt.Sprintf("%s%d", checkIdPrefix(analysisRun, metric), startedAt.UnixNano())
+	ctx, cancel := context.WithCancel(p.ctx)
+	check := &pluginCheck{cancel: cancel, interval: checkConfig.PollInterval, done: make(chan struct{})}
+	p.mu.Lock()
+	p.checks[checkId] = check
+	p.mu.Unlock()
+
+	logger := p.logger.With("analysisRun", analysisRun.Namespace+"/"+analysisRun.Name, "metric", metric.Name)
+	go func() {
+		defer close(check.done)
+		defer cancel()
+		start := time.Now()
+		apps, findErr := findApps(ctx, checkConfig, p.argoAppClient, p.argoAppSetClient, logger)
+		if findErr != nil {
+			logger.Error("Failed to find apps to verify", "error", findErr)
+			check.report = newReport(start, nil, findErr.Error())
+			return
+		}
+		check.report = newReport(start, verifyApps(ctx, checkConfig, p.argoAppClient, apps, start, logger), "")
+		logger.Info("Check completed", "inExpectedState", check.report.InExpectedState, "exitCode", check.report.ExitCode)
+	}()
+
+	measurement.Phase = v1alpha1.AnalysisPhaseRunning
+	measurement.Metadata = map[string]string{checkMetadataKey: checkId}
+	resumeAt := metav1.NewTime(time.Now().Add(checkConfig.PollInterval))
+	measurement.ResumeAt = &resumeAt
+	return measurement
+}
+
+// Resume completes the measurement when the verification is done.
+func (p *rolloutsPlugin) Resume(_ *v1alpha1.AnalysisRun, metric v1alpha1.Metric, measurement v1alpha1.Measurement) v1alpha1.Measurement {
+	checkId := measurement.Metadata[checkMetadataKey]
+	p.mu.Lock()
+	check, found := p.checks[checkId]
+	p.mu.Unlock()
+	if !found {
+		// The plugin was restarted while the verification was running
+		return metricutil.MarkMeasurementError(measurement, fmt.Errorf("verification %s is no longer running", checkId))
+	}
+
+	select {
+	case <-check.done:
+	default:
+		resumeAt := metav1.NewTime(time.Now().Add(check.interval))
+		measurement.ResumeAt = &resumeAt
+		return measurement
+	}
+
+	p.mu.Lock()
+	delete(p.checks, checkId)
+	p.mu.Unlock()
+	var value bytes.Buffer
+	if err := check.report.WriteJSON(&value); err != nil {
+		return metricutil.MarkMeasurementError(measurement, err)
+	}
+	phase, err := measurementPhase(metric, check.report, value.Bytes())
+	if err != nil {
+		return metricutil.MarkMeasurementError(measurement, err)
+	}
+	finishedAt := metav1.Now()
+	measurement.Value = strings.TrimSpace(value.String())
+	measurement.Phase = phase
+	measurement.Message = check.report.FailureReason
+	measurement.FinishedAt = &finishedAt
+	measurement.ResumeAt = nil
+	return measurement
+}
+
+// Terminate stops the verification when the AnalysisRun is terminated.
+func (p *rolloutsPlugin) Terminate(_ *v1alpha1.AnalysisRun, _ v1alpha1.Metric, measurement v1alpha1.Measurement) v1alpha1.Measurement {
+	checkId := measurement.Metadata[checkMetadataKey]
+	p.mu.Lock()
+	if check, found := p.checks[checkId]; found {
+		check.cancel()
+		delete(p.checks, checkId)
+	}
+	p.mu.Unlock()
+	finishedAt := metav1.Now()
+	measurement.FinishedAt = &finishedAt
+	measurement.Phase = v1alpha1.AnalysisPhaseSuccessful
+	return measurement
+}
+
+// GarbageCollect forgets the finished verifications of the metric that no running measurement will resume anymore.
+func (p *rolloutsPlugin) GarbageCollect(analysisRun *v1alpha1.AnalysisRun, metric v1alpha1.Metric, _ int) types.RpcError {
+	resumed := map[string]bool{}
+	for _, result := range analysisRun.Status.MetricResults {
+		if result.Name != metric.Name {
+			continue
+		}
+		for _, measurement := range result.Measurements {
+			if measurement.Phase == v1alpha1.AnalysisPhaseRunning {
+				resumed[measurement.Metadata[checkMetadataKey]] = true
+			}
+		}
+	}
+
+	prefix := checkIdPrefix(analysisRun, metric)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for checkId, check := range p.checks {
+		if !strings.HasPrefix(checkId, prefix) || resumed[checkId] {
+			continue
+		}
+		select {
+		case <-check.done:
+			delete(p.checks, checkId)
+		default:
+		}
+	}
+	return types.RpcError{}
+}
+
+// wait blocks until all checks are done.
+func (p *rolloutsPlugin) wait() {
+	p.mu.Lock()
+	var running []*pluginCheck
+	for _, check := range p.checks {
+		running = append(running, check)
+	}
+	p.mu.Unlock()
+	for _, check := range running {
+		<-check.done
+	}
+}
+
+func (p *rolloutsPlugin) Type() string {
+	return "RPCPlugin"
+}
+
+func (p *rolloutsPlugin) GetMetadata(v1alpha1.Metric) map[string]string {
+	return nil
+}
+
+// checkIdPrefix is the start of the identifiers of the verifications of a metric in an AnalysisRun.
+func checkIdPrefix(analysisRun *v1alpha1.AnalysisRun, metric v1alpha1.Metric) string {
+	return fmt.Sprintf("%s/%s/", analysisRun.UID, metric.Name)
+}
+
+// measurementPhase evaluates the successCondition and failureCondition of the metric against the report.
+// Without conditions, the measurement is successful when all apps are in the expected state.
+func measurementPhase(metric v1alpha1.Metric, report internal.Report, value []byte) (v1alpha1.AnalysisPhase, error) {
+	if metric.SuccessCondition == "" && metric.FailureCondition == "" {
+		if report.InExpectedState {
+			return v1alpha1.AnalysisPhaseSuccessful, nil
+		}
+		return v1alpha1.AnalysisPhaseFailed, nil
+	}
+	var result map[string]any
+	if err := json.Unmarshal(value, &result); err != nil {
+		return v1alpha1.AnalysisPhaseError, err
+	}
+	return evaluate.EvaluateResult(result, metric, *logrus.NewEntry(logrus.StandardLogger()))
+}
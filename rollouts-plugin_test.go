@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	argocd "github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	"github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+	"github.com/argoproj/gitops-engine/pkg/health"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"maps"
+	"rwslinkman/kargo-promotion-check-ext-argo/internal"
+	"rwslinkman/kargo-promotion-check-ext-argo/internal/fakeargocd"
+	"slices"
+	"testing"
+	"time"
+)
+
+var testAnalysisRun = &v1alpha1.AnalysisRun{ObjectMeta: metav1.ObjectMeta{Name: "api-canary", Namespace: "apps", UID: "run-uid"}}
+
+// startRolloutsPlugin creates the plugin, connected to the fake ArgoCD.
+func startRolloutsPlugin(t *testing.T, server *fakeargocd.Server) *rolloutsPlugin {
+	t.Helper()
+	argoAppClient, argoAppSetClient := connectFakeArgoCD(t, server, nil)
+	return newRolloutsPlugin(context.Background(), argoAppClient, argoAppSetClient, testLogger)
+}
+
+// pluginMetric configures the metric with the settings of the plugin.
+func pluginMetric(settings string) v1alpha1.Metric {
+	return v1alpha1.Metric{
+		Name: "argo-app-synced",
+		Provider: v1alpha1.MetricProvider{
+			Plugin: map[string]json.RawMessage{pluginName: json.RawMessage(settings)},
+		},
+	}
+}
+
+// waitForCheck waits until the verification of the measurement is done.
+func waitForCheck(t *testing.T, plugin *rolloutsPlugin, measurement v1alpha1.Measurement) {
+	t.Helper()
+	plugin.mu.Lock()
+	check, found := plugin.checks[measurement.Metadata[checkMetadataKey]]
+	plugin.mu.Unlock()
+	if !found {
+		t.Fatalf("no verification is running for the measurement")
+	}
+	select {
+	case <-check.done:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("verification did not finish")
+	}
+}
+
+func TestRolloutsPlugin_Run_InvalidSettings(t *testing.T) {
+	server := startFakeArgoCD(t)
+	plugin := startRolloutsPlugin(t, server)
+	tests := []struct {
+		name     string
+		settings string
+		message  string
+	}{
+		{"unsupported setting", `{"app": "api", "colour": "blue"}`, "provided plugin setting 'colour' is not supported"},
+		{"no revision", `{"app": "api"}`, "KPCEA_TARGET_REVISION or KPCEA_TARGET_REVISIONS must be set for verification mode EXACT"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			measurement := plugin.Run(testAnalysisRun, pluginMetric(test.settings))
+
+			assert.Equal(t, v1alpha1.AnalysisPhaseError, measurement.Phase)
+			assert.Equal(t, test.message, measurement.Message)
+			assert.Empty(t, plugin.checks)
+		})
+	}
+}
+
+func TestRolloutsPlugin_RunResume_InExpectedState(t *testing.T) {
+	server := startFakeArgoCD(t)
+	server.ScriptApp("api", fakeargocd.App("api", argocd.SyncStatusCodeSynced, health.HealthStatusHealthy, e2eRevision))
+	plugin := startRolloutsPlugin(t, server)
+	metric := pluginMetric(`{"app": "api", "revision": "3f2a9c1"}`)
+
+	measurement := plugin.Run(testAnalysisRun, metric)
+
+	assert.Equal(t, v1alpha1.AnalysisPhaseRunning, measurement.Phase)
+	assert.NotNil(t, measurement.StartedAt)
+	assert.NotNil(t, measurement.ResumeAt)
+	assert.Contains(t, measurement.Metadata[checkMetadataKey], "run-uid/argo-app-synced/")
+	assert.Len(t, plugin.checks, 1)
+
+	waitForCheck(t, plugin, measurement)
+	measurement = plugin.Resume(testAnalysisRun, metric, measurement)
+
+	assert.Equal(t, v1alpha1.AnalysisPhaseSuccessful, measurement.Phase)
+	assert.NotNil(t, measurement.FinishedAt)
+	assert.Nil(t, measurement.ResumeAt)
+	assert.Empty(t, measurement.Message)
+	var value internal.Report
+	assert.NoError(t, json.Unmarshal([]byte(measurement.Value), &value))
+	assert.True(t, value.InExpectedState)
+	assert.Equal(t, "api", value.Apps[0].App)
+	assert.Empty(t, plugin.checks)
+}
+
+func TestRolloutsPlugin_RunResume_NotInExpectedState(t *testing.T) {
+	server := startFakeArgoCD(t)
+	server.ScriptApp("api", fakeargocd.App("api", argocd.SyncStatusCodeOutOfSync, health.HealthStatusHealthy, e2eRevision))
+	plugin := startRolloutsPlugin(t, server)
+	metric := pluginMetric(`{"app": "api", "revision": "3f2a9c1", "timeout": 1}`)
+
+	measurement := plugin.Run(testAnalysisRun, metric)
+	waitForCheck(t, plugin, measurement)
+	measurement = plugin.Resume(testAnalysisRun, metric, measurement)
+
+	assert.Equal(t, v1alpha1.AnalysisPhaseFailed, measurement.Phase)
+	var value internal.Report
+	assert.NoError(t, json.Unmarshal([]byte(measurement.Value), &value))
+	assert.False(t, value.InExpectedState)
+	assert.Equal(t, "app did not reach the expected state within 1s: app is OutOfSync and Healthy", value.Apps[0].FailureReason)
+	assert.Empty(t, plugin.checks)
+}
+
+func TestRolloutsPlugin_Resume_StillRunning(t *testing.T) {
+	server := startFakeArgoCD(t)
+	server.ScriptApp("api", fakeargocd.App("api", argocd.SyncStatusCodeOutOfSync, health.HealthStatusHealthy, e2eRevision))
+	plugin := startRolloutsPlugin(t, server)
+	metric := pluginMetric(`{"app": "api", "revision": "3f2a9c1", "timeout": 60}`)
+	measurement := plugin.Run(testAnalysisRun, metric)
+	started := *measurement.ResumeAt
+
+	measurement = plugin.Resume(testAnalysisRun, metric, measurement)
+
+	assert.Equal(t, v1alpha1.AnalysisPhaseRunning, measurement.Phase)
+	assert.Nil(t, measurement.FinishedAt)
+	assert.False(t, measurement.ResumeAt.Before(&started))
+	assert.Len(t, plugin.checks, 1)
+
+	plugin.mu.Lock()
+	check := plugin.checks[measurement.Metadata[checkMetadataKey]]
+	plugin.mu.Unlock()
+	measurement = plugin.Terminate(testAnalysisRun, metric, measurement)
+
+	assert.Equal(t, v1alpha1.AnalysisPhaseSuccessful, measurement.Phase)
+	assert.NotNil(t, measurement.FinishedAt)
+	assert.Empty(t, plugin.checks)
+	select {
+	case <-check.done:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("verification was not stopped")
+	}
+}
+
+func TestRolloutsPlugin_StoppedAbortsChecks(t *testing.T) {
+	server := startFakeArgoCD(t)
+	server.ScriptApp("api", fakeargocd.App("api", argocd.SyncStatusCodeOutOfSync, health.HealthStatusHealthy, e2eRevision))
+	argoAppClient, argoAppSetClient := connectFakeArgoCD(t, server, nil)
+	ctx, stop := context.WithCancelCause(context.Background())
+	plugin := newRolloutsPlugin(ctx, argoAppClient, argoAppSetClient, testLogger)
+	metric := pluginMetric(`{"app": "api", "revision": "3f2a9c1", "timeout": 60}`)
+	measurement := plugin.Run(testAnalysisRun, metric)
+
+	stop(errors.New("terminated signal received"))
+	plugin.wait()
+	measurement = plugin.Resume(testAnalysisRun, metric, measurement)
+
+	assert.Equal(t, v1alpha1.AnalysisPhaseFailed, measurement.Phase)
+	var value internal.Report
+	assert.NoError(t, json.Unmarshal([]byte(measurement.Value), &value))
+	assert.Equal(t, exitAborted, value.ExitCode)
+	assert.Equal(t, "verification was aborted: terminated signal received", value.Apps[0].FailureReason)
+}
+
+func TestRolloutsPlugin_Resume_UnknownCheck(t *testing.T) {
+	plugin := newRolloutsPlugin(context.Background(), nil, nil, testLogger)
+	measurement := v1alpha1.Measurement{
+		Phase:    v1alpha1.AnalysisPhaseRunning,
+		Metadata: map[string]string{checkMetadataKey: "run-uid/argo-app-synced/1"},
+	}
+
+	measurement = plugin.Resume(testAnalysisRun, pluginMetric(`{}`), measurement)
+
+	assert.Equal(t, v1alpha1.AnalysisPhaseError, measurement.Phase)
+	assert.Equal(t, "verification run-uid/argo-app-synced/1 is no longer running", measurement.Message)
+}
+
+func TestRolloutsPlugin_Terminate_UnknownCheck(t *testing.T) {
+	plugin := newRolloutsPlugin(context.Background(), nil, nil, testLogger)
+	measurement := v1alpha1.Measurement{
+		Phase:    v1alpha1.AnalysisPhaseRunning,
+		Metadata: map[string]string{checkMetadataKey: "run-uid/argo-app-synced/1"},
+	}
+
+	measurement = plugin.Terminate(testAnalysisRun, pluginMetric(`{}`), measurement)
+
+	assert.Equal(t, v1alpha1.AnalysisPhaseSuccessful, measurement.Phase)
+	assert.NotNil(t, measurement.FinishedAt)
+}
+
+func TestRolloutsPlugin_GarbageCollect(t *testing.T) {
+	finished := make(chan struct{})
+	close(finished)
+	plugin := newRolloutsPlugin(context.Background(), nil, nil, testLogger)
+	plugin.checks = map[string]*pluginCheck{
+		"run-uid/argo-app-synced/1":   {done: finished},
+		"run-uid/argo-app-synced/2":   {done: finished},
+		"run-uid/argo-app-synced/3":   {done: make(chan struct{})},
+		"run-uid/argo-app-healthy/1":  {done: finished},
+		"other-uid/argo-app-synced/1": {done: finished},
+	}
+	analysisRun := testAnalysisRun.DeepCopy()
+	analysisRun.Status.MetricResults = []v1alpha1.MetricResult{{
+		Name: "argo-app-synced",
+		Measurements: []v1alpha1.Measurement{
+			{Phase: v1alpha1.AnalysisPhaseSuccessful, Metadata: map[string]string{checkMetadataKey: "run-uid/argo-app-synced/1"}},
+			{Phase: v1alpha1.AnalysisPhaseRunning, Metadata: map[string]string{checkMetadataKey: "run-uid/argo-app-synced/2"}},
+			{Phase: v1alpha1.AnalysisPhaseRunning, Metadata: map[string]string{checkMetadataKey: "run-uid/argo-app-synced/3"}},
+		},
+	}}
+
+	err := plugin.GarbageCollect(analysisRun, pluginMetric(`{}`), 10)
+
+	assert.False(t, err.HasError())
+	assert.Equal(t, []string{"other-uid/argo-app-synced/1", "run-uid/argo-app-healthy/1", "run-uid/argo-app-synced/2", "run-uid/argo-app-synced/3"}, slices.Sorted(maps.Keys(plugin.checks)))
+}
+
+func TestMeasurementPhase(t *testing.T) {
+	tests := []struct {
+		name             string
+		successCondition string
+		failureCondition string
+		report           internal.Report
+		phase            v1alpha1.AnalysisPhase
+	}{
+		{"default in expected state", "", "", internal.Report{InExpectedState: true}, v1alpha1.AnalysisPhaseSuccessful},
+		{"default not in expected state", "", "", internal.Report{ExitCode: exitNotInState}, v1alpha1.AnalysisPhaseFailed},
+		{"success condition met", "result.inExpectedState == true", "", internal.Report{InExpectedState: true}, v1alpha1.AnalysisPhaseSuccessful},
+		{"success condition not met", "result.inExpectedState == true", "", internal.Report{ExitCode: exitNotInState}, v1alpha1.AnalysisPhaseFailed},
+		{"failure condition met", "", "result.exitCode == 2", internal.Report{ExitCode: exitTerminalFailure}, v1alpha1.AnalysisPhaseFailed},
+		{"failure condition not met", "", "result.exitCode == 2", internal.Report{ExitCode: exitNotInState}, v1alpha1.AnalysisPhaseSuccessful},
+		{"conditions override the default", "result.exitCode == 1", "", internal.Report{ExitCode: exitNotInState}, v1alpha1.AnalysisPhaseSuccessful},
+		{"neither condition met", "result.exitCode == 0", "result.exitCode == 2", internal.Report{ExitCode: exitNotInState}, v1alpha1.AnalysisPhaseInconclusive},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			metric := v1alpha1.Metric{SuccessCondition: test.successCondition, FailureCondition: test.failureCondition}
+			value, _ := json.Marshal(test.report)
+
+			phase, err := measurementPhase(metric, test.report, value)
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.phase, phase)
+		})
+	}
+}
+
+func TestMeasurementPhase_InvalidCondition(t *testing.T) {
+	metric := v1alpha1.Metric{SuccessCondition: "result.inExpectedState =="}
+	value, _ := json.Marshal(internal.Report{InExpectedState: true})
+
+	phase, err := measurementPhase(metric, internal.Report{InExpectedState: true}, value)
+
+	assert.Error(t, err)
+	assert.Equal(t, v1alpha1.AnalysisPhaseError, phase)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/argoproj/argo-cd/v2/pkg/apiclient/application"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"rwslinkman/kargo-promotion-check-ext-argo/internal"
+	"rwslinkman/kargo-promotion-check-ext-argo/internal/verifier"
+	"syscall"
+	"time"
+)
+
+// serverShutdownTimeout is how long the server waits for the aborted checks to respond when it is stopped
+const serverShutdownTimeout = 10 * time.Second
+
+// serve runs KPCEA as an HTTP server, so the verification can be used as a web metric of Argo Rollouts.
+// The connection to ArgoCD is configured once, each check configures the app and verification with query parameters.
+func serve() {
+	config, err := internal.LoadServerConfig()
+	if err != nil {
+		logger := internal.NewLogger(os.Stdout, internal.TextLog, slog.LevelInfo, internal.NewRedactor())
+		logger.Error("Invalid configuration", "error", err)
+		os.Exit(exitSetupFailure)
+	}
+
+	redactor := internal.NewRedactor(config.ArgoApiToken, config.ApiPassword)
+	logger := internal.NewLogger(os.Stdout, config.LogFormat, config.LogLevel, redactor)
+	logger.Info("KPCEA server started", "authMode", config.AuthMode, "address", config.ListenAddress)
+
+	// Stop when Kubernetes terminates the pod, this also cancels logging in and the running checks
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	argoAppClient, argoAppSetClient, err := connect(ctx, config, redactor, logger)
+	if err != nil {
+		if reason, aborted := verifier.AbortReason(ctx); aborted {
+			logger.Warn("KPCEA server was stopped before it connected to ArgoCD", "reason", reason)
+			os.Exit(exitAborted)
+		}
+		// The reason was logged by connect
+		os.Exit(exitSetupFailure)
+	}
+
+	server := &http.Server{
+		Addr:        config.ListenAddress,
+		Handler:     newServeMux(argoAppClient, argoAppSetClient, logger),
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.ListenAndServe()
+	}()
+	select {
+	case err = <-serveErr:
+		logger.Error("KPCEA server stopped", "error", err)
+		os.Exit(exitSetupFailure)
+	case <-ctx.Done():
+	}
+
+	// The running checks are aborted, wait until they responded
+	logger.Info("KPCEA server is shutting down", "reason", context.Cause(ctx))
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), serverShutdownTimeout)
+	defer cancelShutdown()
+	if err = server.Shutdown(shutdownCtx); err != nil {
+		logger.Error("KPCEA server did not shut down gracefully", "error", err)
+		os.Exit(exitAborted)
+	}
+	logger.Info("KPCEA server stopped")
+}
+
+// newServeMux routes the check and health requests of serve mode.
+func newServeMux(argoAppClient application.ApplicationServiceClient, argoAppSetClient internal.ApplicationSetGetClient, logger *slog.Logger) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/check", func(w http.ResponseWriter, r *http.Request) {
+		checkConfig, configErr := internal.LoadCheckConfig(r.URL.Query())
+		if configErr != nil {
+			logger.Warn("Invalid check request", "error", configErr)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(checkError{Error: configErr.Error()})
+			return
+		}
+
+		start := time.Now()
+		checkLogger := logger.With("request", r.URL.RawQuery)
+		apps, findErr := findApps(r.Context(), checkConfig, argoAppClient, argoAppSetClient, checkLogger)
+		var results []internal.AppResult
+		failureReason := ""
+		if findErr != nil {
+			checkLogger.Error("Failed to find apps to verify", "error", findErr)
+			failureReason = findErr.Error()
+		} else {
+			results = verifyApps(r.Context(), checkConfig, argoAppClient, apps, start, checkLogger)
+		}
+		report := newReport(start, results, failureReason)
+		checkLogger.Info("Check completed", "inExpectedState", report.InExpectedState, "exitCode", report.ExitCode)
+		w.Header().Set("Content-Type", "application/json")
+		if writeErr := report.WriteJSON(w); writeErr != nil {
+			checkLogger.Error("Failed to write check response", "error", writeErr)
+		}
+	})
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	return mux
+}
+
+// checkError is the response body of a check request that can not be performed.
+type checkError struct {
+	Error string `json:"error"`
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/argoproj/argo-cd/v2/pkg/apiclient/application"
+	"github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	"github.com/argoproj/gitops-engine/pkg/health"
+	"github.com/stretchr/testify/assert"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"rwslinkman/kargo-promotion-check-ext-argo/internal"
+	"rwslinkman/kargo-promotion-check-ext-argo/internal/fakeargocd"
+	"testing"
+)
+
+var testLogger = slog.New(slog.DiscardHandler)
+
+// startServeMode configures serve mode with the environment variables, and connects it to the fake ArgoCD.
+func startServeMode(t *testing.T, server *fakeargocd.Server, env map[string]string) *httptest.Server {
+	t.Helper()
+	argoAppClient, argoAppSetClient := connectFakeArgoCD(t, server, env)
+	kpcea := httptest.NewServer(newServeMux(argoAppClient, argoAppSetClient, testLogger))
+	t.Cleanup(kpcea.Close)
+	return kpcea
+}
+
+// connectFakeArgoCD loads the server configuration from the environment variables, and connects to the fake ArgoCD.
+func connectFakeArgoCD(t *testing.T, server *fakeargocd.Server, env map[string]string) (application.ApplicationServiceClient, internal.ApplicationSetGetClient) {
+	t.Helper()
+	t.Setenv("ARGOCD_SERVER", "http://"+server.Addr)
+	t.Setenv("ARGOCD_API_TOKEN", "api-token")
+	t.Setenv("KPCEA_INTERVAL", "1")
+	t.Setenv("KPCEA_TIMEOUT", "10")
+	for key, value := range env {
+		t.Setenv(key, value)
+	}
+	config, err := internal.LoadServerConfig()
+	if err != nil {
+		t.Fatalf("invalid server configuration: %v", err)
+	}
+	argoAppClient, argoAppSetClient, err := connect(context.Background(), config, internal.NewRedactor(), testLogger)
+	if err != nil {
+		t.Fatalf("failed to connect to fake ArgoCD: %v", err)
+	}
+	return argoAppClient, argoAppSetClient
+}
+
+// getJSON performs the request, and decodes the JSON response.
+func getJSON(t *testing.T, url string) (*http.Response, map[string]any) {
+	t.Helper()
+	response, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer response.Body.Close()
+	var body map[string]any
+	if err = json.NewDecoder(response.Body).Decode(&body); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	return response, body
+}
+
+func TestServe_Check_InExpectedState(t *testing.T) {
+	server := startFakeArgoCD(t)
+	server.ScriptApp("api", fakeargocd.App("api", v1alpha1.SyncStatusCodeSynced, health.HealthStatusHealthy, e2eRevision))
+	kpcea := startServeMode(t, server, nil)
+
+	response, body := getJSON(t, kpcea.URL+"/v1/check?app=api&revision=3f2a9c1")
+
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "application/json", response.Header.Get("Content-Type"))
+	assert.Equal(t, true, body["inExpectedState"])
+	assert.Equal(t, float64(exitSuccess), body["exitCode"])
+	assert.Contains(t, body, "elapsedSeconds")
+	assert.NotContains(t, body, "failureReason")
+	apps := body["apps"].([]any)
+	assert.Len(t, apps, 1)
+	app := apps[0].(map[string]any)
+	assert.Equal(t, "api", app["app"])
+	assert.Equal(t, "3f2a9c1", app["expectedRevision"])
+	assert.Equal(t, e2eRevision, app["observedRevision"])
+	assert.Equal(t, "Synced", app["syncStatus"])
+	assert.Equal(t, "Healthy", app["healthStatus"])
+	assert.Equal(t, float64(1), app["attempts"])
+	assert.Equal(t, float64(exitSuccess), app["exitCode"])
+}
+
+func TestServe_Check_NotInExpectedState(t *testing.T) {
+	server := startFakeArgoCD(t)
+	server.ScriptApp("api", fakeargocd.App("api", v1alpha1.SyncStatusCodeOutOfSync, health.HealthStatusHealthy, e2eRevision))
+	kpcea := startServeMode(t, server, nil)
+
+	response, body := getJSON(t, kpcea.URL+"/v1/check?app=api&revision=3f2a9c1&timeout=1")
+
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, false, body["inExpectedState"])
+	assert.Equal(t, float64(exitNotInState), body["exitCode"])
+	app := body["apps"].([]any)[0].(map[string]any)
+	assert.Equal(t, "app did not reach the expected state within 1s: app is OutOfSync and Healthy", app["failureReason"])
+}
+
+func TestServe_Check_ParamsOverrideEnv(t *testing.T) {
+	server := startFakeArgoCD(t)
+	server.ScriptApp("api", fakeargocd.App("api", v1alpha1.SyncStatusCodeSynced, health.HealthStatusHealthy, e2eRevision))
+	kpcea := startServeMode(t, server, map[string]string{
+		"ARGOCD_APP_NAME":       "other-app",
+		"KPCEA_TARGET_REVISION": "9b8c7d6",
+	})
+
+	_, body := getJSON(t, kpcea.URL+"/v1/check?app=api&revision=3f2a9c1")
+
+	assert.Equal(t, true, body["inExpectedState"])
+	app := body["apps"].([]any)[0].(map[string]any)
+	assert.Equal(t, "api", app["app"])
+	assert.Equal(t, "3f2a9c1", app["expectedRevision"])
+}
+
+func TestServe_Check_EnvIsDefault(t *testing.T) {
+	server := startFakeArgoCD(t)
+	server.ScriptApp("api", fakeargocd.App("api", v1alpha1.SyncStatusCodeSynced, health.HealthStatusHealthy, e2eRevision))
+	kpcea := startServeMode(t, server, map[string]string{
+		"ARGOCD_APP_NAME":       "api",
+		"KPCEA_TARGET_REVISION": "3f2a9c1",
+	})
+
+	_, body := getJSON(t, kpcea.URL+"/v1/check")
+
+	assert.Equal(t, true, body["inExpectedState"])
+}
+
+func TestServe_Check_InvalidParams(t *testing.T) {
+	server := startFakeArgoCD(t)
+	kpcea := startServeMode(t, server, nil)
+	tests := []struct {
+		name  string
+		query string
+		error string
+	}{
+		{"no app", "revision=3f2a9c1", "ARGOCD_SERVER and ARGOCD_APP_NAME must be set"},
+		{"no revision", "app=api", "KPCEA_TARGET_REVISION or KPCEA_TARGET_REVISIONS must be set for verification mode EXACT"},
+		{"invalid timeout", "app=api&revision=3f2a9c1&timeout=soon", "provided KPCEA_TIMEOUT must be a number"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response, body := getJSON(t, kpcea.URL+"/v1/check?"+test.query)
+
+			assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+			assert.Equal(t, "application/json", response.Header.Get("Content-Type"))
+			assert.Equal(t, map[string]any{"error": test.error}, body)
+		})
+	}
+}
+
+func TestServe_Check_UnknownApp(t *testing.T) {
+	server := startFakeArgoCD(t)
+	kpcea := startServeMode(t, server, nil)
+
+	response, body := getJSON(t, kpcea.URL+"/v1/check?app=missing&revision=3f2a9c1&timeout=1")
+
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, false, body["inExpectedState"])
+	assert.Equal(t, float64(exitNotInState), body["exitCode"])
+	app := body["apps"].([]any)[0].(map[string]any)
+	assert.Contains(t, app["failureReason"], `applications.argoproj.io "missing" not found`)
+}
+
+func TestServe_Check_LogsInAgainWhenSessionExpires(t *testing.T) {
+	server := startFakeArgoCD(t)
+	server.SetLogin("kpcea", "password")
+	server.ScriptApp("api", fakeargocd.App("api", v1alpha1.SyncStatusCodeSynced, health.HealthStatusHealthy, e2eRevision))
+	kpcea := startServeMode(t, server, map[string]string{
+		"ARGOCD_API_TOKEN":    "",
+		"ARGOCD_API_USERNAME": "kpcea",
+		"ARGOCD_API_PASSWORD": "password",
+	})
+
+	_, first := getJSON(t, kpcea.URL+"/v1/check?app=api&revision=3f2a9c1")
+	server.SetToken("next-session")
+	_, second := getJSON(t, kpcea.URL+"/v1/check?app=api&revision=3f2a9c1")
+
+	assert.Equal(t, true, first["inExpectedState"])
+	assert.Equal(t, true, second["inExpectedState"])
+	assert.Equal(t, float64(1), second["apps"].([]any)[0].(map[string]any)["attempts"])
+}
+
+func TestServe_Check_TokenFileIsBeingRotated(t *testing.T) {
+	server := startFakeArgoCD(t)
+	server.ScriptApp("api", fakeargocd.App("api", v1alpha1.SyncStatusCodeSynced, health.HealthStatusHealthy, e2eRevision))
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("api-token"), 0o600); err != nil {
+		t.Fatalf("failed to write token file: %v", err)
+	}
+	kpcea := startServeMode(t, server, map[string]string{
+		"ARGOCD_API_TOKEN":      "",
+		"ARGOCD_API_TOKEN_FILE": tokenFile,
+	})
+	// The file is briefly missing while the token is rotated
+	_ = os.Remove(tokenFile)
+
+	response, body := getJSON(t, kpcea.URL+"/v1/check?app=api&revision=3f2a9c1")
+
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, true, body["inExpectedState"])
+}
+
+func TestServe_Healthz(t *testing.T) {
+	server := startFakeArgoCD(t)
+	kpcea := startServeMode(t, server, nil)
+
+	response, err := http.Get(kpcea.URL + "/healthz")
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	_ = response.Body.Close()
+}
+
+func TestServe_UnknownRoute(t *testing.T) {
+	server := startFakeArgoCD(t)
+	kpcea := startServeMode(t, server, nil)
+
+	response, err := http.Post(kpcea.URL+"/v1/check", "application/json", nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusMethodNotAllowed, response.StatusCode)
+	_ = response.Body.Close()
+}